@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rulePredicate compares a member field with a value. "today" stands for the
+// current date, so "expiration_date>=today" holds until the membership ends.
+type rulePredicate struct {
+	field string
+	op    string
+	value string
+}
+
+// activeRule says when a member is active: any of its alternatives, each
+// requiring all of its predicates.
+type activeRule [][]rulePredicate
+
+// defaultActiveRule is active until the expiration date, and forever for
+// lifetime memberships, whose expiration date is empty.
+var defaultActiveRule = activeRule{
+	{{field: "expiration_date", op: ">=", value: "today"}},
+	{{field: "expiration_date", op: "=", value: "0001-01-01"}},
+}
+
+var ruleOperators = []string{">=", "<=", "!=", "=", ">", "<"}
+
+// parseActiveRule parses rules like
+// "status=paid & paid_through>=today | lifetime=true": "|" separates
+// alternatives and "&" the predicates they all require.
+func parseActiveRule(expression string, known map[string]bool) (activeRule, error) {
+	var rule activeRule
+	for _, alternative := range strings.Split(expression, "|") {
+		var predicates []rulePredicate
+		for _, term := range strings.Split(alternative, "&") {
+			term = strings.TrimSpace(term)
+			predicate := rulePredicate{}
+			for _, op := range ruleOperators {
+				if field, value, found := strings.Cut(term, op); found {
+					predicate = rulePredicate{field: strings.TrimSpace(field), op: op, value: strings.TrimSpace(value)}
+					break
+				}
+			}
+			if predicate.op == "" {
+				return nil, fmt.Errorf("ACTIVE_RULE term %q has no comparison", term)
+			}
+			if !known[predicate.field] {
+				return nil, fmt.Errorf("ACTIVE_RULE has unknown field %q", predicate.field)
+			}
+			predicates = append(predicates, predicate)
+		}
+		rule = append(rule, predicates)
+	}
+	return rule, nil
+}
+
+func loadActiveRule(schema *Schema) (activeRule, error) {
+	expression := os.Getenv("ACTIVE_RULE")
+	if expression == "" {
+		return defaultActiveRule, nil
+	}
+	return parseActiveRule(expression, filterableFields(schema))
+}
+
+// compareValues orders two field values as numbers when both are numbers,
+// and as text otherwise, which also orders YYYY-MM-DD dates.
+func compareValues(a, b string) int {
+	x, errX := strconv.ParseFloat(a, 64)
+	y, errY := strconv.ParseFloat(b, 64)
+	if errX == nil && errY == nil {
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+func (p rulePredicate) holds(m Member, now time.Time) bool {
+	want := p.value
+	if strings.EqualFold(want, "today") {
+		want = now.Format("2006-01-02")
+	}
+	for _, value := range memberFieldValues(m, p.field) {
+		c := compareValues(value, want)
+		var ok bool
+		switch p.op {
+		case "=":
+			ok = c == 0
+		case "!=":
+			ok = c != 0
+		case ">=":
+			ok = c >= 0
+		case "<=":
+			ok = c <= 0
+		case ">":
+			ok = c > 0
+		case "<":
+			ok = c < 0
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (rule activeRule) active(m Member, now time.Time) bool {
+	for _, alternative := range rule {
+		all := true
+		for _, predicate := range alternative {
+			if !predicate.holds(m, now) {
+				all = false
+				break
+			}
+		}
+		if all {
+			return true
+		}
+	}
+	return false
+}
+
+// Status is "active" or "inactive" according to the active rule.
+func (m Member) Status(rule activeRule, now time.Time) string {
+	if rule.active(m, now) {
+		return "active"
+	}
+	return "inactive"
+}
+
+// membershipField is the computed field holding Member.Status. API filters,
+// the XLSX export and home page groups take it next to the roster fields,
+// so it can't be a schema column name; "status" is left to the roster.
+const membershipField = "membership"
+
+// ruledFieldValues is memberFieldValues with the membership field computed
+// under the active rule.
+func ruledFieldValues(m Member, field string, rule activeRule, now time.Time) []string {
+	if field == membershipField {
+		return []string{m.Status(rule, now)}
+	}
+	return memberFieldValues(m, field)
+}
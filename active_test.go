@@ -0,0 +1,170 @@
+package main
+
+import (
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func date(value string) time.Time {
+	parsed, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		panic(err)
+	}
+	return parsed
+}
+
+func TestParseActiveRule(t *testing.T) {
+	known := map[string]bool{"status": true, "paid_through": true, "lifetime": true, "expiration_date": true}
+	tests := []struct {
+		expression string
+		want       activeRule
+		wantErr    bool
+	}{
+		{
+			expression: "status=paid",
+			want:       activeRule{{{field: "status", op: "=", value: "paid"}}},
+		},
+		{
+			expression: "status=paid & paid_through>=today | lifetime=true",
+			want: activeRule{
+				{{field: "status", op: "=", value: "paid"}, {field: "paid_through", op: ">=", value: "today"}},
+				{{field: "lifetime", op: "=", value: "true"}},
+			},
+		},
+		{
+			expression: " status != lapsed ",
+			want:       activeRule{{{field: "status", op: "!=", value: "lapsed"}}},
+		},
+		{
+			expression: "paid_through<=2026-12-31|expiration_date>today",
+			want: activeRule{
+				{{field: "paid_through", op: "<=", value: "2026-12-31"}},
+				{{field: "expiration_date", op: ">", value: "today"}},
+			},
+		},
+		{expression: "status", wantErr: true},
+		{expression: "status=paid &", wantErr: true},
+		{expression: "tier=gold", wantErr: true},
+		{expression: "membership=active", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			got, err := parseActiveRule(tt.expression, known)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseActiveRule(%q) = %v, want an error", tt.expression, got)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseActiveRule(%q) = %v, %v, want %v", tt.expression, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestActiveRule(t *testing.T) {
+	now := date("2026-10-14")
+	rule, err := parseActiveRule("status=paid & paid_through>=today | lifetime=true", map[string]bool{"status": true, "paid_through": true, "lifetime": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		extra  map[string]string
+		rule   activeRule
+		expiry time.Time
+		want   string
+	}{
+		{"paid and current", map[string]string{"status": "PAID", "paid_through": "2026-10-14"}, rule, time.Time{}, "active"},
+		{"paid but lapsed", map[string]string{"status": "paid", "paid_through": "2026-10-13"}, rule, time.Time{}, "inactive"},
+		{"unpaid", map[string]string{"status": "due", "paid_through": "2027-01-01"}, rule, time.Time{}, "inactive"},
+		{"lifetime", map[string]string{"lifetime": "true"}, rule, time.Time{}, "active"},
+		{"default rule, not expired", nil, defaultActiveRule, date("2026-10-14"), "active"},
+		{"default rule, expired", nil, defaultActiveRule, date("2026-10-13"), "inactive"},
+		{"default rule, lifetime", nil, defaultActiveRule, time.Time{}, "active"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := Member{Extra: tt.extra, ExpirationDate: tt.expiry}
+			if got := m.Status(tt.rule, now); got != tt.want {
+				t.Errorf("Status() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// A roster column named status stays filterable next to the computed
+// membership field.
+func TestFilterStatusColumnAndMembership(t *testing.T) {
+	t.Setenv("ACTIVE_RULE", "status=paid")
+	schema := &Schema{Columns: []Column{{Name: "status", Header: "status", Type: "string"}, {Name: "join_date", Header: "join_date", Type: "date"}}}
+	paid := Member{ID: "1", Extra: map[string]string{"status": "paid"}}
+	due := Member{ID: "2", Extra: map[string]string{"status": "due"}}
+
+	tests := []struct {
+		query string
+		want  []Member
+	}{
+		{"status=paid", []Member{paid}},
+		{"status=due", []Member{due}},
+		{"membership=active", []Member{paid}},
+		{"membership=inactive", []Member{due}},
+		{"status=due&membership=active", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			filter, err := parseMemberFilter(query, schema)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []Member
+			for _, m := range []Member{paid, due} {
+				if filter.matches(m) {
+					got = append(got, m)
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matched %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchemaReservesMembership(t *testing.T) {
+	schema := &Schema{Columns: []Column{{Name: "membership", Header: "m", Type: "string"}, {Name: "join_date", Header: "join_date", Type: "date"}}}
+	if err := schema.validate(); err == nil {
+		t.Error("a schema column named membership was accepted")
+	}
+}
+
+// "&" binds tighter than "|": "a | b & c" is "a | (b & c)".
+func TestActiveRulePrecedence(t *testing.T) {
+	now := date("2026-10-14")
+	rule, err := parseActiveRule("lifetime=true | status=paid & paid_through>=today", map[string]bool{"status": true, "paid_through": true, "lifetime": true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		lifetime, status, paidThrough string
+		want                          string
+	}{
+		{"true", "due", "2020-01-01", "active"},
+		{"true", "", "", "active"},
+		{"false", "paid", "2026-10-14", "active"},
+		{"false", "paid", "2026-10-13", "inactive"},
+		{"false", "due", "2027-01-01", "inactive"},
+		{"", "", "2027-01-01", "inactive"},
+	}
+	for _, tt := range tests {
+		m := Member{Extra: map[string]string{"lifetime": tt.lifetime, "status": tt.status, "paid_through": tt.paidThrough}}
+		if got := m.Status(rule, now); got != tt.want {
+			t.Errorf("Status(lifetime=%q status=%q paid_through=%q) = %q, want %q", tt.lifetime, tt.status, tt.paidThrough, got, tt.want)
+		}
+	}
+}
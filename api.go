@@ -0,0 +1,432 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// corsConfig is read from CORS_ALLOWED_ORIGINS (comma separated, "*" for any
+// origin), CORS_ALLOWED_METHODS and CORS_ALLOWED_HEADERS. Without allowed
+// origins no CORS headers are sent and browsers keep the same-origin policy.
+type corsConfig struct {
+	origins []string
+	methods string
+	headers string
+}
+
+func loadCorsConfig() corsConfig {
+	config := corsConfig{
+		origins: splitList(os.Getenv("CORS_ALLOWED_ORIGINS"), ","),
+		methods: os.Getenv("CORS_ALLOWED_METHODS"),
+		headers: os.Getenv("CORS_ALLOWED_HEADERS"),
+	}
+	if config.methods == "" {
+		config.methods = "GET, OPTIONS"
+	}
+	if config.headers == "" {
+		config.headers = "Authorization, Content-Type"
+	}
+	return config
+}
+
+func (c corsConfig) allows(origin string) bool {
+	for _, allowed := range c.origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// withCors applies the CORS configuration to an /api route, answering
+// preflight requests itself.
+func withCors(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		config := loadCorsConfig()
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if origin == "" || len(config.origins) == 0 {
+			if preflight {
+				http.Error(w, "CORS is not enabled", http.StatusForbidden)
+				return
+			}
+			next(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Origin")
+		if !config.allows(origin) {
+			if preflight {
+				http.Error(w, "origin not allowed", http.StatusForbidden)
+				return
+			}
+			next(w, r)
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Origin", origin)
+		if preflight {
+			w.Header().Set("Access-Control-Allow-Methods", config.methods)
+			w.Header().Set("Access-Control-Allow-Headers", config.headers)
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// MembersResponse is a page of members. Paged responses carry the snapshot
+// they were cut from and, but for the last page, the URL of the next one.
+type MembersResponse struct {
+	Members  []Member `json:"members"`
+	Snapshot string   `json:"snapshot,omitempty"`
+	Next     string   `json:"next,omitempty"`
+}
+
+// Pagination parameters of /api/members, which are not filters.
+var pageParams = map[string]bool{"limit": true, "offset": true, "snapshot": true}
+
+// apiSnapshotTtl reads API_SNAPSHOT_TTL, how long a paginated client can keep
+// reading the roster as it was on its first page (default 10m).
+func apiSnapshotTtl() (time.Duration, error) {
+	return durationFromEnv("API_SNAPSHOT_TTL", 10*time.Minute)
+}
+
+// apiSnapshotMax reads API_SNAPSHOT_MAX, how many roster snapshots are kept
+// at once (default 100). Past it the oldest is dropped and its clients
+// restart from the first page.
+func apiSnapshotMax() (int, error) {
+	value := os.Getenv("API_SNAPSHOT_MAX")
+	if value == "" {
+		return 100, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("API_SNAPSHOT_MAX must be a positive number, got %q", value)
+	}
+	return limit, nil
+}
+
+type rosterSnapshot struct {
+	members     []Member
+	fingerprint string
+	createdAt   time.Time
+}
+
+// rosterSnapshots pins the roster for paginating clients, so a refresh
+// between two pages doesn't shift their results. Clients starting on the
+// same roster share its snapshot.
+var rosterSnapshots struct {
+	sync.Mutex
+	byToken map[string]rosterSnapshot
+}
+
+func rosterFingerprint(members []Member) (string, error) {
+	encoded, err := json.Marshal(members)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func saveSnapshot(members []Member, ttl time.Duration) (string, error) {
+	limit, err := apiSnapshotMax()
+	if err != nil {
+		return "", err
+	}
+	fingerprint, err := rosterFingerprint(members)
+	if err != nil {
+		return "", err
+	}
+	rosterSnapshots.Lock()
+	defer rosterSnapshots.Unlock()
+	if rosterSnapshots.byToken == nil {
+		rosterSnapshots.byToken = map[string]rosterSnapshot{}
+	}
+	oldest := ""
+	for token, snapshot := range rosterSnapshots.byToken {
+		if time.Since(snapshot.createdAt) > ttl {
+			delete(rosterSnapshots.byToken, token)
+			continue
+		}
+		if snapshot.fingerprint == fingerprint {
+			snapshot.createdAt = time.Now()
+			rosterSnapshots.byToken[token] = snapshot
+			return token, nil
+		}
+		if oldest == "" || snapshot.createdAt.Before(rosterSnapshots.byToken[oldest].createdAt) {
+			oldest = token
+		}
+	}
+	if len(rosterSnapshots.byToken) >= limit {
+		delete(rosterSnapshots.byToken, oldest)
+	}
+
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	rosterSnapshots.byToken[hex.EncodeToString(token)] = rosterSnapshot{members: members, fingerprint: fingerprint, createdAt: time.Now()}
+	return hex.EncodeToString(token), nil
+}
+
+func loadSnapshot(token string, ttl time.Duration) ([]Member, bool) {
+	rosterSnapshots.Lock()
+	defer rosterSnapshots.Unlock()
+	snapshot, ok := rosterSnapshots.byToken[token]
+	if !ok || time.Since(snapshot.createdAt) > ttl {
+		return nil, false
+	}
+	return snapshot.members, true
+}
+
+// pageBounds reads the limit and offset query parameters. limit is 0 when
+// the client doesn't paginate.
+func pageBounds(query url.Values) (limit, offset int, err error) {
+	if value := query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			return 0, 0, fmt.Errorf("limit must be a positive number, got %q", value)
+		}
+	}
+	if value := query.Get("offset"); value != "" {
+		if offset, err = strconv.Atoi(value); err != nil || offset < 0 {
+			return 0, 0, fmt.Errorf("offset must be a non-negative number, got %q", value)
+		}
+	}
+	return limit, offset, nil
+}
+
+// memberTextField points at a text field of the member by its logical name,
+// and is nil for dates and for extra and list fields.
+func memberTextField(m *Member, field string) *string {
+	switch field {
+	case "id":
+		return &m.ID
+	case "first_name":
+		return &m.FirstName
+	case "last_name":
+		return &m.LastName
+	case "title":
+		return &m.Title
+	case "suffix":
+		return &m.Suffix
+	case "email":
+		return &m.Email
+	case "language":
+		return &m.Language
+	}
+	return nil
+}
+
+// memberFieldValues returns the values of a member field by its logical name,
+// as used in the CSV schema and in the API filters.
+func memberFieldValues(m Member, field string) []string {
+	if text := memberTextField(&m, field); text != nil {
+		return []string{*text}
+	}
+	switch field {
+	case "join_date":
+		return []string{m.JoinDate.Format("2006-01-02")}
+	case "member_since":
+		return []string{m.MemberSince.Format("2006-01-02")}
+	case "expiration_date":
+		return []string{m.ExpirationDate.Format("2006-01-02")}
+	}
+	if values, ok := m.Lists[field]; ok {
+		return values
+	}
+	return []string{m.Extra[field]}
+}
+
+func filterableFields(schema *Schema) map[string]bool {
+	fields := map[string]bool{
+		"id":              true,
+		"first_name":      true,
+		"last_name":       true,
+		"title":           true,
+		"suffix":          true,
+		"email":           true,
+		"language":        true,
+		"join_date":       true,
+		"member_since":    true,
+		"expiration_date": true,
+	}
+	for _, column := range schema.Columns {
+		fields[column.Name] = true
+	}
+	return fields
+}
+
+// memberFilter holds field predicates from the query string. The
+// membership field is computed with the active rule at the time of the
+// request.
+type memberFilter struct {
+	fields map[string][]string
+	rule   activeRule
+	now    time.Time
+}
+
+// parseMemberFilter turns query parameters into field predicates, rejecting
+// fields the roster doesn't know about.
+func parseMemberFilter(query url.Values, schema *Schema) (memberFilter, error) {
+	known := filterableFields(schema)
+	known[membershipField] = true
+	rule, err := loadActiveRule(schema)
+	if err != nil {
+		return memberFilter{}, err
+	}
+	filter := memberFilter{fields: map[string][]string{}, rule: rule, now: time.Now()}
+	for field, values := range query {
+		if pageParams[field] {
+			continue
+		}
+		if !known[field] {
+			return memberFilter{}, fmt.Errorf("unknown filter field %q", field)
+		}
+		filter.fields[field] = values
+	}
+	return filter, nil
+}
+
+// matches is true when the member satisfies every predicate. List fields
+// match when any of their values equals the wanted one.
+func (f memberFilter) matches(m Member) bool {
+	for field, wanted := range f.fields {
+		values := ruledFieldValues(m, field, f.rule, f.now)
+		for _, want := range wanted {
+			found := false
+			for _, value := range values {
+				if strings.EqualFold(value, strings.TrimSpace(want)) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// redactedField returns a filtered field that is redacted for the caller,
+// counting the fields the membership status is computed from. Filtering on
+// them would tell whether a masked value is on the roster.
+func (f memberFilter) redactedField(redacted map[string]bool) (string, bool) {
+	for field := range f.fields {
+		if redacted[field] {
+			return field, true
+		}
+		if field != membershipField {
+			continue
+		}
+		for _, alternative := range f.rule {
+			for _, predicate := range alternative {
+				if redacted[predicate.field] {
+					return predicate.field, true
+				}
+			}
+		}
+	}
+	return "", false
+}
+
+// redactionFor returns the fields redacted for the request, answering 403
+// when its filters read one of them. ok is false when it did.
+func redactionFor(w http.ResponseWriter, r *http.Request, filter memberFilter) (redacted map[string]bool, ok bool) {
+	redacted = map[string]bool{}
+	if !privilegedRequest(r) {
+		redacted = redactedFields()
+	}
+	if field, found := filter.redactedField(redacted); found {
+		http.Error(w, fmt.Sprintf("filtering on the redacted field %q needs the privileged token", field), http.StatusForbidden)
+		return nil, false
+	}
+	return redacted, true
+}
+
+func membersApiHandler(w http.ResponseWriter, r *http.Request) {
+	schema, err := csvSchema()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	query := r.URL.Query()
+	filter, err := parseMemberFilter(query, schema)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit, offset, err := pageBounds(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ttl, err := apiSnapshotTtl()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	redacted, ok := redactionFor(w, r, filter)
+	if !ok {
+		return
+	}
+
+	response := MembersResponse{Members: []Member{}}
+	var members []Member
+	if token := query.Get("snapshot"); token != "" {
+		var ok bool
+		if members, ok = loadSnapshot(token, ttl); !ok {
+			http.Error(w, "snapshot expired or unknown, restart from the first page", http.StatusGone)
+			return
+		}
+		response.Snapshot = token
+	} else {
+		var ok bool
+		if members, ok = serveRoster(w); !ok {
+			return
+		}
+		if limit > 0 {
+			if response.Snapshot, err = saveSnapshot(members, ttl); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	matched := 0
+	for _, member := range members {
+		if !filter.matches(member) {
+			continue
+		}
+		matched++
+		if matched <= offset || (limit > 0 && matched > offset+limit) {
+			continue
+		}
+		response.Members = append(response.Members, redactMember(member, redacted))
+	}
+	if limit > 0 && matched > offset+limit {
+		next := *r.URL
+		nextQuery := next.Query()
+		nextQuery.Set("snapshot", response.Snapshot)
+		nextQuery.Set("offset", strconv.Itoa(offset+limit))
+		next.RawQuery = nextQuery.Encode()
+		response.Next = next.RequestURI()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const apiRoster = `id,first_name,last_name,email,status,join_date
+a1,Jane,Doe,jane@example.com,paid,2026-03-01
+a2,John,Roe,john@example.com,due,2026-03-01
+`
+
+const apiSchema = `{"columns": [
+	{"name": "id", "header": "id", "type": "string"},
+	{"name": "first_name", "header": "first_name", "type": "string"},
+	{"name": "last_name", "header": "last_name", "type": "string"},
+	{"name": "email", "header": "email", "type": "email"},
+	{"name": "status", "header": "status", "type": "string"},
+	{"name": "join_date", "header": "join_date", "type": "date"}
+]}`
+
+// A redacted field can't be probed through the filters: known and unknown
+// values get the same answer.
+func TestFiltersCantProbeRedactedFields(t *testing.T) {
+	serveRosterCsv(t, apiRoster)
+	useSchema(t, apiSchema)
+	t.Setenv("REDACT_FIELDS", "email,status")
+	t.Setenv("API_PRIVILEGED_TOKEN", "s3cret")
+
+	tests := []struct {
+		name       string
+		handler    http.HandlerFunc
+		query      string
+		activeRule string
+		privileged bool
+		wantStatus int
+	}{
+		{"known email", membersApiHandler, "email=jane@example.com", "", false, http.StatusForbidden},
+		{"unknown email", membersApiHandler, "email=nobody@example.com", "", false, http.StatusForbidden},
+		{"membership over a redacted field", membersApiHandler, "membership=active", "status=paid", false, http.StatusForbidden},
+		{"xlsx export", membersXlsxHandler, "email=jane@example.com", "", false, http.StatusForbidden},
+		{"unredacted field", membersApiHandler, "first_name=Jane", "", false, http.StatusOK},
+		{"membership over the default rule", membersApiHandler, "membership=active", "", false, http.StatusOK},
+		{"privileged", membersApiHandler, "email=jane@example.com", "", true, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("ACTIVE_RULE", tt.activeRule)
+			req := httptest.NewRequest(http.MethodGet, "/api/members?"+tt.query, nil)
+			if tt.privileged {
+				req.Header.Set("Authorization", "Bearer s3cret")
+			}
+			rec := httptest.NewRecorder()
+			tt.handler(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestPrivilegedFilterSeesFullValues(t *testing.T) {
+	serveRosterCsv(t, apiRoster)
+	useSchema(t, apiSchema)
+	t.Setenv("REDACT_FIELDS", "email")
+	t.Setenv("API_PRIVILEGED_TOKEN", "s3cret")
+
+	req := httptest.NewRequest(http.MethodGet, "/api/members?email=jane@example.com", nil)
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rec := httptest.NewRecorder()
+	membersApiHandler(rec, req)
+	var response MembersResponse
+	if err := json.NewDecoder(rec.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Members) != 1 || response.Members[0].Email != "jane@example.com" {
+		t.Errorf("privileged filter returned %+v, want Jane unmasked", response.Members)
+	}
+}
+
+func getMembersPage(t *testing.T, target string) MembersResponse {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	membersApiHandler(rec, httptest.NewRequest(http.MethodGet, target, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: status %d: %s", target, rec.Code, rec.Body)
+	}
+	var page MembersResponse
+	if err := json.NewDecoder(rec.Body).Decode(&page); err != nil {
+		t.Fatal(err)
+	}
+	return page
+}
+
+func TestPaginationSurvivesRefresh(t *testing.T) {
+	useSchema(t, apiSchema)
+	serveRosterCsv(t, apiRoster)
+	first := getMembersPage(t, "/api/members?limit=1")
+	if len(first.Members) != 1 || first.Members[0].ID != "a1" || first.Next == "" {
+		t.Fatalf("first page %+v, want a1 and a next page", first)
+	}
+
+	// The roster changes between two pages: a2 leaves, a3 joins first.
+	serveRosterCsv(t, "id,first_name,last_name,email,status,join_date\n"+
+		"a3,Ann,Poe,ann@example.com,paid,2026-03-01\n"+
+		"a1,Jane,Doe,jane@example.com,paid,2026-03-01\n")
+	second := getMembersPage(t, first.Next)
+	if len(second.Members) != 1 || second.Members[0].ID != "a2" || second.Next != "" {
+		t.Errorf("second page %+v, want a2 from the first page's roster and no next page", second)
+	}
+	if fresh := getMembersPage(t, "/api/members?limit=1"); fresh.Members[0].ID != "a3" || fresh.Snapshot == first.Snapshot {
+		t.Errorf("a new pagination got %+v, want the refreshed roster", fresh)
+	}
+
+	rec := httptest.NewRecorder()
+	membersApiHandler(rec, httptest.NewRequest(http.MethodGet, "/api/members?limit=1&offset=1&snapshot=unknown", nil))
+	if rec.Code != http.StatusGone {
+		t.Errorf("unknown snapshot: status %d, want 410", rec.Code)
+	}
+}
+
+func TestSnapshotsAreSharedAndCapped(t *testing.T) {
+	rosterSnapshots.byToken = nil
+	t.Setenv("API_SNAPSHOT_MAX", "3")
+	roster := []Member{{ID: "a1"}}
+	token, err := saveSnapshot(roster, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if again, _ := saveSnapshot([]Member{{ID: "a1"}}, time.Minute); again != token {
+			t.Fatalf("the same roster got a new snapshot %s, want %s", again, token)
+		}
+	}
+	for i := 0; i < 10; i++ {
+		if _, err := saveSnapshot([]Member{{ID: fmt.Sprint(i)}}, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if kept := len(rosterSnapshots.byToken); kept != 3 {
+		t.Errorf("%d snapshots kept, want 3", kept)
+	}
+	if _, ok := loadSnapshot(token, time.Minute); ok {
+		t.Error("the oldest snapshot was kept past API_SNAPSHOT_MAX")
+	}
+}
+
+// Filter predicates on different fields all have to hold, and so do
+// repeated values of one field.
+func TestCombinedFilters(t *testing.T) {
+	useSchema(t, apiSchema)
+	serveRosterCsv(t, apiRoster+"a3,Jane,Poe,jane.poe@example.com,due,2026-03-01\n")
+	t.Setenv("ACTIVE_RULE", "status=paid")
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"first_name=Jane", []string{"a1", "a3"}},
+		{"first_name=jane&status=paid", []string{"a1"}},
+		{"first_name=Jane&status=due", []string{"a3"}},
+		{"first_name=John&status=paid", nil},
+		{"first_name=Jane&membership=inactive", []string{"a3"}},
+		{"first_name=Jane&last_name=Doe&membership=active", []string{"a1"}},
+		{"status=paid&status=due", nil},
+		{"status=paid&status=PAID", []string{"a1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			var got []string
+			for _, m := range getMembersPage(t, "/api/members?"+tt.query).Members {
+				got = append(got, m.ID)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("matched %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWithCors(t *testing.T) {
+	next := func(w http.ResponseWriter, r *http.Request) { fmt.Fprint(w, "members") }
+	tests := []struct {
+		name        string
+		origins     string
+		method      string
+		origin      string
+		wantStatus  int
+		wantAllowed string
+		wantBody    string
+	}{
+		{"preflight from an allowed origin", "https://club.example, https://shop.example", http.MethodOptions, "https://shop.example", http.StatusNoContent, "https://shop.example", ""},
+		{"request from an allowed origin", "https://club.example", http.MethodGet, "https://CLUB.example", http.StatusOK, "https://CLUB.example", "members"},
+		{"any origin", "*", http.MethodOptions, "https://anyone.example", http.StatusNoContent, "https://anyone.example", ""},
+		{"preflight from a denied origin", "https://club.example", http.MethodOptions, "https://evil.example", http.StatusForbidden, "", "origin not allowed\n"},
+		{"request from a denied origin", "https://club.example", http.MethodGet, "https://evil.example", http.StatusOK, "", "members"},
+		{"preflight without CORS", "", http.MethodOptions, "https://club.example", http.StatusForbidden, "", "CORS is not enabled\n"},
+		{"same-origin request", "https://club.example", http.MethodGet, "", http.StatusOK, "", "members"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CORS_ALLOWED_ORIGINS", tt.origins)
+			req := httptest.NewRequest(tt.method, "/api/members", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodGet)
+			}
+			rec := httptest.NewRecorder()
+			withCors(next)(rec, req)
+			if rec.Code != tt.wantStatus || rec.Body.String() != tt.wantBody {
+				t.Errorf("status %d, body %q, want %d, %q", rec.Code, rec.Body, tt.wantStatus, tt.wantBody)
+			}
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllowed {
+				t.Errorf("Access-Control-Allow-Origin %q, want %q", got, tt.wantAllowed)
+			}
+			preflightAllowed := tt.method == http.MethodOptions && tt.wantAllowed != ""
+			if got := rec.Header().Get("Access-Control-Allow-Methods"); (got == "GET, OPTIONS") != preflightAllowed {
+				t.Errorf("Access-Control-Allow-Methods %q", got)
+			}
+			if tt.origin != "" && tt.origins != "" && rec.Header().Get("Vary") != "Origin" {
+				t.Errorf("Vary %q, want Origin", rec.Header().Get("Vary"))
+			}
+		})
+	}
+}
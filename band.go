@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// daysFromEnv reads a number of days, falling back when unset.
+func daysFromEnv(name string, fallback int) (int, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	days, err := strconv.Atoi(value)
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("%s must be a number of days, got %q", name, value)
+	}
+	return days, nil
+}
+
+// DaysUntilExpiration counts the days left in the membership, negative once
+// it has expired.
+func (m Member) DaysUntilExpiration(now time.Time) int {
+	return daysBetween(now, m.ExpirationDate)
+}
+
+// statusBand sorts a member into green, amber or red by how close the
+// membership is to expiring: amber from STATUS_AMBER_DAYS (default 30) days
+// left, red from STATUS_RED_DAYS (default 7) and once expired. Lifetime
+// memberships are green.
+func statusBand(m Member, now time.Time) (string, error) {
+	amber, err := daysFromEnv("STATUS_AMBER_DAYS", 30)
+	if err != nil {
+		return "", err
+	}
+	red, err := daysFromEnv("STATUS_RED_DAYS", 7)
+	if err != nil {
+		return "", err
+	}
+	if red > amber {
+		return "", fmt.Errorf("STATUS_RED_DAYS (%d) can't be more than STATUS_AMBER_DAYS (%d)", red, amber)
+	}
+	if m.ExpirationDate.IsZero() {
+		return "green", nil
+	}
+	switch days := m.DaysUntilExpiration(now); {
+	case days <= red:
+		return "red", nil
+	case days <= amber:
+		return "amber", nil
+	}
+	return "green", nil
+}
+
+// StatusBand is the status band of the member today, for the admin UI.
+func (m Member) StatusBand() (string, error) {
+	return statusBand(m, time.Now())
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatusBand(t *testing.T) {
+	now := date("2026-10-14")
+	tests := []struct {
+		name    string
+		expiry  time.Time
+		amber   string
+		red     string
+		want    string
+		wantErr bool
+	}{
+		{name: "lifetime", want: "green"},
+		{name: "a year left", expiry: date("2027-10-14"), want: "green"},
+		{name: "31 days left", expiry: date("2026-11-14"), want: "green"},
+		{name: "30 days left", expiry: date("2026-11-13"), want: "amber"},
+		{name: "8 days left", expiry: date("2026-10-22"), want: "amber"},
+		{name: "7 days left", expiry: date("2026-10-21"), want: "red"},
+		{name: "expires today", expiry: date("2026-10-14"), want: "red"},
+		{name: "expired", expiry: date("2026-01-01"), want: "red"},
+		{name: "custom bands", expiry: date("2026-10-24"), amber: "60", red: "10", want: "red"},
+		{name: "no amber band", expiry: date("2026-10-24"), amber: "3", red: "3", want: "green"},
+		{name: "red above amber", expiry: date("2026-10-24"), amber: "3", red: "10", wantErr: true},
+		{name: "invalid days", expiry: date("2026-10-24"), amber: "soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("STATUS_AMBER_DAYS", tt.amber)
+			t.Setenv("STATUS_RED_DAYS", tt.red)
+			got, err := statusBand(Member{ExpirationDate: tt.expiry}, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("statusBand() = %q, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("statusBand() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// barcodePlaceholder is the barcode value of cards that don't carry a token.
+const barcodePlaceholder = "BARCODE_VALUE"
+
+// cardBarcodePayload reads CARD_BARCODE_PAYLOAD: "placeholder" (the default)
+// keeps a fixed value in the barcode, "token" puts an opaque token there that
+// only /verify can resolve, so scanning a card reveals nothing about the
+// member. Tokens are signed with BARCODE_TOKEN_SECRET.
+func cardBarcodePayload() (payload string, secret []byte, err error) {
+	payload = os.Getenv("CARD_BARCODE_PAYLOAD")
+	switch payload {
+	case "", "placeholder":
+		return "placeholder", nil, nil
+	case "token":
+	default:
+		return "", nil, fmt.Errorf("CARD_BARCODE_PAYLOAD must be placeholder or token, got %q", payload)
+	}
+	secret = []byte(os.Getenv("BARCODE_TOKEN_SECRET"))
+	if len(secret) < 32 {
+		return "", nil, fmt.Errorf("BARCODE_TOKEN_SECRET must be at least 32 characters when CARD_BARCODE_PAYLOAD is token")
+	}
+	return payload, secret, nil
+}
+
+// barcodeToken is a truncated HMAC of the member ID, which members are
+// looked up by and which can't be recovered from it.
+func barcodeToken(m Member, secret []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("barcode:" + m.ID))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:18])
+}
+
+// cardBarcodeValue is the barcode value for a member's card.
+func cardBarcodeValue(m Member) (string, error) {
+	payload, secret, err := cardBarcodePayload()
+	if err != nil {
+		return "", err
+	}
+	if payload == "placeholder" {
+		return barcodePlaceholder, nil
+	}
+	return barcodeToken(m, secret), nil
+}
+
+// VerifyResult is the answer to a scanned barcode. The member name is only
+// given to privileged requests.
+type VerifyResult struct {
+	Valid          bool   `json:"valid"`
+	Status         string `json:"status,omitempty"`
+	ExpirationDate string `json:"expiration_date,omitempty"`
+	Name           string `json:"name,omitempty"`
+}
+
+// verifyHandler resolves a barcode token to the membership it was issued
+// for, valid when a card could be issued to the member today.
+func verifyHandler(w http.ResponseWriter, r *http.Request) {
+	payload, secret, err := cardBarcodePayload()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if payload != "token" {
+		http.Error(w, "barcode tokens are not enabled", http.StatusNotFound)
+		return
+	}
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "missing token", http.StatusBadRequest)
+		return
+	}
+	schema, err := csvSchema()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rule, err := loadActiveRule(schema)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	members, ok := serveRoster(w)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	result := VerifyResult{}
+	status := http.StatusNotFound
+	for _, member := range members {
+		if !hmac.Equal([]byte(barcodeToken(member, secret)), []byte(token)) {
+			continue
+		}
+		now := time.Now()
+		_, inGrace, err := graceEnd(member, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		status = http.StatusOK
+		result.Valid = rule.active(member, now) || inGrace
+		result.Status = member.Status(rule, now)
+		if !member.ExpirationDate.IsZero() {
+			result.ExpirationDate = member.ExpirationDate.Format("2006-01-02")
+		}
+		if privilegedRequest(r) {
+			result.Name = member.displayName()
+		}
+		break
+	}
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
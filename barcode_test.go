@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const barcodeSecret = "0123456789abcdef0123456789abcdef"
+
+// cardBarcode returns the barcode value on a member's Google card.
+func cardBarcode(t *testing.T, id string) string {
+	t.Helper()
+	rec := requestGoogleCard(t, "id="+id)
+	var card struct {
+		Barcode struct {
+			Value string `json:"value"`
+		} `json:"barcode"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&card); err != nil {
+		t.Fatalf("status %d: %v", rec.Code, err)
+	}
+	return card.Barcode.Value
+}
+
+func verify(t *testing.T, token string, privileged bool) (int, VerifyResult) {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/verify?token="+url.QueryEscape(token), nil)
+	if privileged {
+		req.Header.Set("Authorization", "Bearer s3cret")
+	}
+	rec := httptest.NewRecorder()
+	verifyHandler(rec, req)
+	var result VerifyResult
+	if rec.Header().Get("Content-Type") == "application/json" {
+		if err := json.NewDecoder(rec.Body).Decode(&result); err != nil {
+			t.Fatalf("status %d: %v", rec.Code, err)
+		}
+	}
+	return rec.Code, result
+}
+
+func TestBarcodeTokens(t *testing.T) {
+	serveRosterCsv(t, cardRoster)
+	useSchema(t, apiSchema)
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+	t.Setenv("CARD_BARCODE_PAYLOAD", "token")
+	t.Setenv("BARCODE_TOKEN_SECRET", barcodeSecret)
+	t.Setenv("API_PRIVILEGED_TOKEN", "s3cret")
+	t.Setenv("CARD_EXPIRED_POLICY", "issue")
+
+	jane, john := cardBarcode(t, "a1"), cardBarcode(t, "a2")
+	if jane == john || jane == barcodePlaceholder {
+		t.Fatalf("barcodes %q and %q, want a token per member", jane, john)
+	}
+	for _, pii := range []string{"a1", "jane", "doe", "example", "2026"} {
+		if strings.Contains(strings.ToLower(jane), pii) {
+			t.Errorf("barcode %q carries %q", jane, pii)
+		}
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		privileged bool
+		wantStatus int
+		want       VerifyResult
+	}{
+		{"active member", jane, false, http.StatusOK, VerifyResult{Valid: true, Status: "active", ExpirationDate: "2027-03-01"}},
+		{"privileged", jane, true, http.StatusOK, VerifyResult{Valid: true, Status: "active", ExpirationDate: "2027-03-01", Name: "Jane Doe"}},
+		{"expired member", john, false, http.StatusOK, VerifyResult{Status: "inactive", ExpirationDate: "2021-03-01"}},
+		{"unknown token", strings.Repeat("A", len(jane)), true, http.StatusNotFound, VerifyResult{}},
+		{"missing token", "", false, http.StatusBadRequest, VerifyResult{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, result := verify(t, tt.token, tt.privileged)
+			if status != tt.wantStatus || result != tt.want {
+				t.Errorf("verify() = %d, %+v, want %d, %+v", status, result, tt.wantStatus, tt.want)
+			}
+		})
+	}
+
+	// Another secret gives other tokens, the old ones no longer resolve.
+	t.Setenv("BARCODE_TOKEN_SECRET", strings.Repeat("z", 32))
+	if status, _ := verify(t, jane, false); status != http.StatusNotFound {
+		t.Errorf("a token from the previous secret: status %d, want 404", status)
+	}
+	if rotated := cardBarcode(t, "a1"); rotated == jane {
+		t.Error("the token didn't change with the secret")
+	}
+}
+
+func TestBarcodePayloadConfig(t *testing.T) {
+	tests := []struct {
+		payload, secret string
+		wantErr         bool
+	}{
+		{"", "", false},
+		{"placeholder", "", false},
+		{"token", barcodeSecret, false},
+		{"token", "too short", true},
+		{"email", barcodeSecret, true},
+	}
+	for _, tt := range tests {
+		t.Setenv("CARD_BARCODE_PAYLOAD", tt.payload)
+		t.Setenv("BARCODE_TOKEN_SECRET", tt.secret)
+		if _, _, err := cardBarcodePayload(); (err != nil) != tt.wantErr {
+			t.Errorf("CARD_BARCODE_PAYLOAD %q: %v, want an error: %v", tt.payload, err, tt.wantErr)
+		}
+	}
+
+	t.Setenv("CARD_BARCODE_PAYLOAD", "")
+	if status, _ := verify(t, "anything", false); status != http.StatusNotFound {
+		t.Errorf("verify without tokens enabled: status %d, want 404", status)
+	}
+}
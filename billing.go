@@ -0,0 +1,215 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// billingApi looks up the paid-through date of a member in the club's
+// billing system. BILLING_API_URL holds an {email} or {id} placeholder, e.g.
+// "https://billing.example.org/members?email={email}", and the date is read
+// from the BILLING_PAID_THROUGH path of the JSON answer (default
+// "paid_through"), with the same dotted paths as the JSON roster API.
+// BILLING_API_AUTH_HEADER is sent with each request.
+type billingApi struct {
+	url         string
+	paidThrough string
+	authName    string
+	authValue   string
+}
+
+// loadBillingApi returns ok false when BILLING_API_URL is not set and the
+// roster dates are used as they are.
+func loadBillingApi() (api billingApi, ok bool, err error) {
+	api = billingApi{
+		url:         os.Getenv("BILLING_API_URL"),
+		paidThrough: os.Getenv("BILLING_PAID_THROUGH"),
+	}
+	if api.url == "" {
+		return billingApi{}, false, nil
+	}
+	if !strings.Contains(api.url, "{email}") && !strings.Contains(api.url, "{id}") {
+		return billingApi{}, false, fmt.Errorf("BILLING_API_URL must contain {email} or {id}")
+	}
+	if api.paidThrough == "" {
+		api.paidThrough = "paid_through"
+	}
+	if api.authName, api.authValue, err = authHeaderFromEnv("BILLING_API_AUTH_HEADER"); err != nil {
+		return billingApi{}, false, err
+	}
+	return api, true, nil
+}
+
+func billingCacheTtl() (time.Duration, error) {
+	return durationFromEnv("BILLING_CACHE_TTL", 15*time.Minute)
+}
+
+func (b billingApi) memberUrl(m Member) string {
+	return strings.NewReplacer(
+		"{email}", url.QueryEscape(m.Email),
+		"{id}", url.QueryEscape(m.ID),
+	).Replace(b.url)
+}
+
+// billingStatus is what the billing system knows about a member. found is
+// false when it has no record, and the roster is kept as it is.
+type billingStatus struct {
+	found       bool
+	paidThrough time.Time
+	fetchedAt   time.Time
+}
+
+// billingCache holds billing answers by lookup URL. Stale entries are kept
+// to stand in for the billing system while it is down.
+var billingCache struct {
+	sync.Mutex
+	statuses map[string]billingStatus
+}
+
+func (b billingApi) fetch(memberUrl string) (billingStatus, error) {
+	client, err := outboundClient("BILLING_API_TIMEOUT", 5*time.Second)
+	if err != nil {
+		return billingStatus{}, err
+	}
+	req, err := http.NewRequest(http.MethodGet, memberUrl, nil)
+	if err != nil {
+		return billingStatus{}, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if b.authName != "" {
+		req.Header.Set(b.authName, b.authValue)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		// The lookup URL holds the member's email or ID, which may be
+		// redacted, so it is left out of the error.
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return billingStatus{}, err
+	}
+	defer resp.Body.Close()
+	status := billingStatus{fetchedAt: time.Now()}
+	if resp.StatusCode == http.StatusNotFound {
+		return status, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return billingStatus{}, fmt.Errorf("billing API answered %s", resp.Status)
+	}
+
+	var body any
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return billingStatus{}, fmt.Errorf("error decoding billing API answer: %v", err)
+	}
+	value, ok := lookupPath(body, b.paidThrough)
+	if !ok || value == nil {
+		return status, nil
+	}
+	date, ok := value.(string)
+	if !ok {
+		return billingStatus{}, fmt.Errorf("billing API %s is not a date: %v", b.paidThrough, value)
+	}
+	if status.paidThrough, err = parseDate(date); err != nil {
+		return billingStatus{}, fmt.Errorf("billing API %s: %v", b.paidThrough, err)
+	}
+	status.found = true
+	return status, nil
+}
+
+// billingConcurrency reads BILLING_API_CONCURRENCY, how many billing
+// lookups run at once while the roster loads (default 8).
+func billingConcurrency() (int, error) {
+	value := os.Getenv("BILLING_API_CONCURRENCY")
+	if value == "" {
+		return 8, nil
+	}
+	concurrency, err := strconv.Atoi(value)
+	if err != nil || concurrency <= 0 {
+		return 0, fmt.Errorf("BILLING_API_CONCURRENCY must be a positive number, got %q", value)
+	}
+	return concurrency, nil
+}
+
+// withBillingStatus replaces the expiration date of each member with the
+// date they are paid through, when the billing API is configured and knows
+// them. It is applied to the roster as it is loaded, so cards, verification,
+// the member pages and the exports all see the billing dates. Lookups run
+// BILLING_API_CONCURRENCY at a time. While the billing system is down the
+// last known answers are used, or the roster when there are none; once a
+// lookup fails the rest of the roster isn't looked up again, so a down
+// billing system costs about one timeout per load.
+func withBillingStatus(members []Member) ([]Member, error) {
+	api, ok, err := loadBillingApi()
+	if err != nil || !ok {
+		return members, err
+	}
+	ttl, err := billingCacheTtl()
+	if err != nil {
+		return members, err
+	}
+	concurrency, err := billingConcurrency()
+	if err != nil {
+		return members, err
+	}
+
+	var down atomic.Bool
+	lookups := make(chan int)
+	var wg sync.WaitGroup
+	for range min(concurrency, len(members)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range lookups {
+				members[i] = api.apply(members[i], ttl, &down)
+			}
+		}()
+	}
+	for i := range members {
+		lookups <- i
+	}
+	close(lookups)
+	wg.Wait()
+	return members, nil
+}
+
+// apply sets one member's billing date, fetching it when the cached answer
+// is older than ttl and the billing system isn't known to be down. The first
+// failed lookup marks it down.
+func (b billingApi) apply(m Member, ttl time.Duration, down *atomic.Bool) Member {
+	memberUrl := b.memberUrl(m)
+	billingCache.Lock()
+	cached, ok := billingCache.statuses[memberUrl]
+	billingCache.Unlock()
+	status := cached
+	if !down.Load() && (!ok || time.Since(cached.fetchedAt) >= ttl) {
+		fetched, err := b.fetch(memberUrl)
+		if err != nil {
+			if down.CompareAndSwap(false, true) {
+				log.Printf("Billing API unavailable for member %s, keeping the last known or roster dates for this load: %v", m.ID, err)
+			}
+		} else {
+			status = fetched
+			billingCache.Lock()
+			if billingCache.statuses == nil {
+				billingCache.statuses = map[string]billingStatus{}
+			}
+			billingCache.statuses[memberUrl] = status
+			billingCache.Unlock()
+		}
+	}
+	if status.found {
+		m.ExpirationDate = status.paidThrough
+	}
+	return m
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func billingServer(t *testing.T, up *atomic.Bool) (url string, requests *atomic.Int32) {
+	t.Helper()
+	requests = &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		switch {
+		case !up.Load():
+			http.Error(w, "down", http.StatusBadGateway)
+		case r.URL.Query().Get("id") == "a1":
+			w.Write([]byte(`{"paid_through": "2027-06-30"}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/members?id={id}", requests
+}
+
+func TestWithBillingStatus(t *testing.T) {
+	roster := func() []Member {
+		return []Member{
+			{ID: "a1", ExpirationDate: date("2026-06-30")},
+			{ID: "a2", ExpirationDate: date("2026-03-31")},
+			{ID: "a3", ExpirationDate: date("2026-01-31")},
+		}
+	}
+	tests := []struct {
+		name         string
+		up           bool
+		want         []string
+		wantRequests int32
+	}{
+		{"billing dates replace roster dates", true, []string{"2027-06-30", "2026-03-31", "2026-01-31"}, 3},
+		{"down billing keeps the roster after one lookup", false, []string{"2026-06-30", "2026-03-31", "2026-01-31"}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			billingCache.statuses = nil
+			// One lookup at a time, so the down case makes a single request.
+			t.Setenv("BILLING_API_CONCURRENCY", "1")
+			up := &atomic.Bool{}
+			up.Store(tt.up)
+			url, requests := billingServer(t, up)
+			t.Setenv("BILLING_API_URL", url)
+
+			members, err := withBillingStatus(roster())
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i, m := range members {
+				if got := m.ExpirationDate.Format("2006-01-02"); got != tt.want[i] {
+					t.Errorf("member %s expires %s, want %s", m.ID, got, tt.want[i])
+				}
+			}
+			if got := requests.Load(); got != tt.wantRequests {
+				t.Errorf("billing API got %d requests, want %d", got, tt.wantRequests)
+			}
+		})
+	}
+}
+
+// Cached answers stand in for the billing system while it is down.
+func TestWithBillingStatusCached(t *testing.T) {
+	billingCache.statuses = nil
+	up := &atomic.Bool{}
+	up.Store(true)
+	url, requests := billingServer(t, up)
+	t.Setenv("BILLING_API_URL", url)
+	if _, err := withBillingStatus([]Member{{ID: "a1"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("BILLING_CACHE_TTL", "1ns")
+	up.Store(false)
+	members, err := withBillingStatus([]Member{{ID: "a1", ExpirationDate: date("2026-06-30")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := members[0].ExpirationDate.Format("2006-01-02"); got != "2027-06-30" || requests.Load() != 2 {
+		t.Errorf("member expires %s after %d requests, want the cached 2027-06-30 after 2", got, requests.Load())
+	}
+}
+
+func TestBillingLookupsAreBounded(t *testing.T) {
+	billingCache.statuses = nil
+	var inFlight, most atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		current := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			seen := most.Load()
+			if current <= seen || most.CompareAndSwap(seen, current) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	t.Setenv("BILLING_API_URL", server.URL+"/members?id={id}")
+	t.Setenv("BILLING_API_CONCURRENCY", "3")
+
+	var members []Member
+	for i := 0; i < 20; i++ {
+		members = append(members, Member{ID: fmt.Sprintf("m%d", i)})
+	}
+	if _, err := withBillingStatus(members); err != nil {
+		t.Fatal(err)
+	}
+	if got := most.Load(); got < 2 || got > 3 {
+		t.Errorf("%d lookups ran at once, want 2 to 3", got)
+	}
+}
+
+// The lookup URL holds the member's email, which stays out of the logs.
+func TestBillingFailureLogsNoLookupUrl(t *testing.T) {
+	billingCache.statuses = nil
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+	}))
+	defer server.Close()
+	t.Setenv("BILLING_API_URL", server.URL+"/members?email={email}")
+	t.Setenv("BILLING_API_TIMEOUT", "10ms")
+	t.Setenv("REDACT_FIELDS", "email")
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	if _, err := withBillingStatus([]Member{{ID: "a1", Email: "jane@example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(logs.String(), "member a1") {
+		t.Errorf("failure not logged: %q", logs.String())
+	}
+	if strings.Contains(logs.String(), "jane") || strings.Contains(logs.String(), server.URL) {
+		t.Errorf("log shows the lookup URL: %q", logs.String())
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+)
+
+type ClassSlot struct {
+	Name      string
+	FieldPath string
+}
+
+// ClassRow is one row of the card template, holding up to three text
+// modules of the object.
+type ClassRow struct {
+	Kind  string
+	Slots []ClassSlot
+}
+
+type ClassData struct {
+	ClassId string
+	Rows    []ClassRow
+}
+
+var classRowSlots = map[int]struct {
+	kind  string
+	slots []string
+}{
+	1: {"oneItem", []string{"item"}},
+	2: {"twoItems", []string{"startItem", "endItem"}},
+	3: {"threeItems", []string{"startItem", "middleItem", "endItem"}},
+}
+
+// classRows lays the object's text modules out three per row, in the order of
+// the card field layout.
+func classRows(layout FieldLayout) []ClassRow {
+	var rows []ClassRow
+	fields := layout["text"]
+	for start := 0; start < len(fields); start += 3 {
+		end := min(start+3, len(fields))
+		shape := classRowSlots[end-start]
+		row := ClassRow{Kind: shape.kind}
+		for i, field := range fields[start:end] {
+			row.Slots = append(row.Slots, ClassSlot{
+				Name:      shape.slots[i],
+				FieldPath: fmt.Sprintf("object.textModulesData['%s']", field),
+			})
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+// googleClassHandler renders the generic class matching google_card.json, for
+// uploading to the Wallet console when setting up a program.
+func googleClassHandler(w http.ResponseWriter, r *http.Request) {
+	classId, err := googleClassId()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	schema, err := csvSchema()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	layout, err := cardFieldLayout(schema)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	classJson, err := renderJsonTemplate("./google_class.json", ClassData{ClassId: classId, Rows: classRows(layout)})
+	if err != nil {
+		http.Error(w, "Error generating class JSON: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	fmt.Fprintln(w, classJson)
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// googleClass is the part of the rendered class the test reads back: each
+// row maps its kind to slots, each slot to the field paths it shows.
+type googleClass struct {
+	ID                string `json:"id"`
+	ClassTemplateInfo struct {
+		CardTemplateOverride struct {
+			CardRowTemplateInfos []map[string]map[string]struct {
+				FirstValue struct {
+					Fields []struct {
+						FieldPath string `json:"fieldPath"`
+					} `json:"fields"`
+				} `json:"firstValue"`
+			} `json:"cardRowTemplateInfos"`
+		} `json:"cardTemplateOverride"`
+	} `json:"classTemplateInfo"`
+}
+
+func TestGoogleClass(t *testing.T) {
+	useSchema(t, `{"columns": [
+		{"name": "id", "header": "id", "type": "string"},
+		{"name": "chapter", "header": "chapter", "type": "string"},
+		{"name": "tier", "header": "tier", "type": "string"},
+		{"name": "join_date", "header": "join_date", "type": "date"}
+	]}`)
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+
+	tests := []struct {
+		layout string
+		want   []map[string][]string
+	}{
+		{"", []map[string][]string{
+			{"twoItems/startItem": {"object.textModulesData['expiration_date']"}, "twoItems/endItem": {"object.textModulesData['countdown']"}},
+		}},
+		{"text=chapter", []map[string][]string{
+			{"oneItem/item": {"object.textModulesData['chapter']"}},
+		}},
+		{"text=expiration_date,countdown,chapter,tier", []map[string][]string{
+			{
+				"threeItems/startItem":  {"object.textModulesData['expiration_date']"},
+				"threeItems/middleItem": {"object.textModulesData['countdown']"},
+				"threeItems/endItem":    {"object.textModulesData['chapter']"},
+			},
+			{"oneItem/item": {"object.textModulesData['tier']"}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.layout, func(t *testing.T) {
+			t.Setenv("CARD_FIELD_LAYOUT", tt.layout)
+			rec := httptest.NewRecorder()
+			googleClassHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/google-class.json", nil))
+			if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+				t.Fatalf("status %d, Content-Type %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+			}
+			var class googleClass
+			if err := json.Unmarshal(rec.Body.Bytes(), &class); err != nil {
+				t.Fatalf("the class is not valid JSON: %v\n%s", err, rec.Body)
+			}
+			if class.ID != "3388000000012345678.members" {
+				t.Errorf("class id %q, want GOOGLE_CLASS_ID", class.ID)
+			}
+			var rows []map[string][]string
+			for _, row := range class.ClassTemplateInfo.CardTemplateOverride.CardRowTemplateInfos {
+				slots := map[string][]string{}
+				for kind, items := range row {
+					for name, item := range items {
+						for _, field := range item.FirstValue.Fields {
+							slots[kind+"/"+name] = append(slots[kind+"/"+name], field.FieldPath)
+						}
+					}
+				}
+				rows = append(rows, slots)
+			}
+			if !reflect.DeepEqual(rows, tt.want) {
+				t.Errorf("rows %v, want %v", rows, tt.want)
+			}
+		})
+	}
+}
+
+func TestGoogleClassNeedsClassId(t *testing.T) {
+	t.Setenv("GOOGLE_CLASS_ID", "")
+	rec := httptest.NewRecorder()
+	googleClassHandler(rec, httptest.NewRequest(http.MethodGet, "/admin/google-class.json", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", rec.Code)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+)
+
+const (
+	defaultCardColor = "#b8b8b8"
+	expiredCardColor = "#757575"
+)
+
+// normalizeHexColor accepts #rgb and #rrggbb colors and returns them as
+// lowercase #rrggbb, the form both wallets take. ok is false for anything
+// else.
+func normalizeHexColor(value string) (color string, ok bool) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if !strings.HasPrefix(value, "#") {
+		return "", false
+	}
+	digits := value[1:]
+	for _, r := range digits {
+		if !strings.ContainsRune("0123456789abcdef", r) {
+			return "", false
+		}
+	}
+	switch len(digits) {
+	case 3:
+		return "#" + string([]byte{digits[0], digits[0], digits[1], digits[1], digits[2], digits[2]}), true
+	case 6:
+		return value, true
+	}
+	return "", false
+}
+
+// tierColors reads CARD_TIER_COLORS, e.g. "gold=#d4af37,silver=#c0c0c0".
+func tierColors() (map[string]string, error) {
+	colors := map[string]string{}
+	for _, entry := range splitList(os.Getenv("CARD_TIER_COLORS"), ",") {
+		tier, value, _ := strings.Cut(entry, "=")
+		color, ok := normalizeHexColor(value)
+		if !ok {
+			return nil, fmt.Errorf("CARD_TIER_COLORS entry %q must look like tier=#rrggbb", entry)
+		}
+		colors[strings.ToLower(strings.TrimSpace(tier))] = color
+	}
+	return colors, nil
+}
+
+// cardExpiredColor reads CARD_EXPIRED_COLOR, the background of cards whose
+// membership has expired, so they stand out at a glance.
+func cardExpiredColor() (string, error) {
+	value := os.Getenv("CARD_EXPIRED_COLOR")
+	if value == "" {
+		return expiredCardColor, nil
+	}
+	color, ok := normalizeHexColor(value)
+	if !ok {
+		return "", fmt.Errorf("CARD_EXPIRED_COLOR must be a #rrggbb color, got %q", value)
+	}
+	return color, nil
+}
+
+// cardColor is the card background: the member's own card_color column when
+// it holds a valid hex color, else the color of their tier, else the default.
+func cardColor(m Member) (string, error) {
+	if value := m.Extra["card_color"]; value != "" {
+		if color, ok := normalizeHexColor(value); ok {
+			return color, nil
+		}
+		log.Printf("Warning: member %s has an invalid card color %q, using the tier color", m.ID, value)
+	}
+	tiers, err := tierColors()
+	if err != nil {
+		return "", err
+	}
+	if color, ok := tiers[strings.ToLower(m.Extra["tier"])]; ok {
+		return color, nil
+	}
+	return defaultCardColor, nil
+}
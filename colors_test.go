@@ -0,0 +1,74 @@
+package main
+
+import "testing"
+
+func TestNormalizeHexColor(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   string
+		wantOk bool
+	}{
+		{"#d4af37", "#d4af37", true},
+		{" #D4AF37 ", "#d4af37", true},
+		{"#fA0", "#ffaa00", true},
+		{"d4af37", "", false},
+		{"#d4af3", "", false},
+		{"#d4af37ff", "", false},
+		{"#g4af37", "", false},
+		{"gold", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		if got, ok := normalizeHexColor(tt.value); got != tt.want || ok != tt.wantOk {
+			t.Errorf("normalizeHexColor(%q) = %q, %v, want %q, %v", tt.value, got, ok, tt.want, tt.wantOk)
+		}
+	}
+}
+
+func TestCardColor(t *testing.T) {
+	t.Setenv("CARD_TIER_COLORS", "gold=#d4af37, silver=#ccc")
+	tests := []struct {
+		name  string
+		extra map[string]string
+		want  string
+	}{
+		{"valid member color", map[string]string{"card_color": "#1E88E5", "tier": "gold"}, "#1e88e5"},
+		{"short member color", map[string]string{"card_color": "#08f"}, "#0088ff"},
+		{"invalid member color falls back to the tier", map[string]string{"card_color": "blue", "tier": "Gold"}, "#d4af37"},
+		{"invalid member color without a tier", map[string]string{"card_color": "#12345"}, defaultCardColor},
+		{"absent member color", map[string]string{"tier": "silver"}, "#cccccc"},
+		{"absent member color and unknown tier", map[string]string{"tier": "bronze"}, defaultCardColor},
+		{"nothing set", nil, defaultCardColor},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := cardColor(Member{ID: "a1", Extra: tt.extra}); err != nil || got != tt.want {
+				t.Errorf("cardColor() = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+
+	t.Setenv("CARD_TIER_COLORS", "gold=yellow")
+	if got, err := cardColor(Member{ID: "a1"}); err == nil {
+		t.Errorf("cardColor() with an invalid CARD_TIER_COLORS = %q, want an error", got)
+	}
+}
+
+func TestCardExpiredColor(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"", expiredCardColor, false},
+		{"#A00", "#aa0000", false},
+		{"grey", "", true},
+	}
+	for _, tt := range tests {
+		t.Setenv("CARD_EXPIRED_COLOR", tt.value)
+		got, err := cardExpiredColor()
+		if got != tt.want || (err != nil) != tt.wantErr {
+			t.Errorf("CARD_EXPIRED_COLOR %q: cardExpiredColor() = %q, %v, want %q", tt.value, got, err, tt.want)
+		}
+	}
+}
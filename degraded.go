@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// googleCardsUnavailable lists why Google cards can't be issued, one reason
+// per missing setting. The roster pages and API don't need these settings
+// and keep working without them.
+func googleCardsUnavailable() []string {
+	var reasons []string
+	if _, err := googleApplicationCredentials(); err != nil {
+		reasons = append(reasons, err.Error())
+	}
+	if _, err := googleClassId(); err != nil {
+		reasons = append(reasons, err.Error())
+	}
+	return reasons
+}
+
+// degradedModeAllowed reads DEGRADED_MODE. Unless it is "false", the server
+// starts without the Google card settings and only disables the card
+// endpoints; with "false" it refuses to start.
+func degradedModeAllowed() bool {
+	return os.Getenv("DEGRADED_MODE") != "false"
+}
+
+// requireGoogleCards answers 503 with the missing settings on Google card
+// endpoints while the server runs in degraded mode.
+func requireGoogleCards(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if reasons := googleCardsUnavailable(); len(reasons) > 0 {
+			http.Error(w, "Google cards are disabled: "+strings.Join(reasons, "; "), http.StatusServiceUnavailable)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// ServerStatus is the /status report: whether warm-up is done, which
+// features are disabled and why, and when the roster was last fetched.
+type ServerStatus struct {
+	Ready           bool     `json:"ready"`
+	Degraded        bool     `json:"degraded"`
+	Disabled        []string `json:"disabled,omitempty"`
+	Reasons         []string `json:"reasons,omitempty"`
+	RosterFetchedAt string   `json:"roster_fetched_at,omitempty"`
+}
+
+func statusHandler(w http.ResponseWriter, r *http.Request) {
+	status := ServerStatus{Ready: ready.Load()}
+	if reasons := googleCardsUnavailable(); len(reasons) > 0 {
+		status.Degraded = true
+		status.Disabled = []string{"google_cards"}
+		status.Reasons = reasons
+	}
+	lastGoodRoster.Lock()
+	if !lastGoodRoster.fetchedAt.IsZero() {
+		status.RosterFetchedAt = lastGoodRoster.fetchedAt.Format(time.RFC3339)
+	}
+	lastGoodRoster.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if err := json.NewEncoder(w).Encode(status); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
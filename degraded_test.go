@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDegradedMode(t *testing.T) {
+	serveRosterCsv(t, cardRoster)
+	useSchema(t, apiSchema)
+	wasReady := ready.Load()
+	ready.Store(true)
+	t.Cleanup(func() { ready.Store(wasReady) })
+
+	tests := []struct {
+		name         string
+		credentials  string
+		classId      string
+		wantStatus   int
+		wantReasons  []string
+		wantDisabled []string
+	}{
+		{"configured", "/etc/wallet.json", "3388000000012345678.members", http.StatusOK, nil, nil},
+		{"no credentials", "", "3388000000012345678.members", http.StatusServiceUnavailable, []string{
+			"GOOGLE_APPLICATION_CREDENTIALS environment variable is not set",
+		}, []string{"google_cards"}},
+		{"nothing set", "", "", http.StatusServiceUnavailable, []string{
+			"GOOGLE_APPLICATION_CREDENTIALS environment variable is not set",
+			"GOOGLE_CLASS_ID environment variable is not set",
+		}, []string{"google_cards"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("GOOGLE_APPLICATION_CREDENTIALS", tt.credentials)
+			t.Setenv("GOOGLE_CLASS_ID", tt.classId)
+			for path, handler := range map[string]http.HandlerFunc{
+				"/card/generate_google?id=a1": requireGoogleCards(generateGoogleCardHandler),
+				"/admin/google-class.json":    requireGoogleCards(googleClassHandler),
+			} {
+				rec := httptest.NewRecorder()
+				handler(rec, httptest.NewRequest(http.MethodGet, path, nil))
+				if rec.Code != tt.wantStatus {
+					t.Errorf("%s: status %d, want %d: %s", path, rec.Code, tt.wantStatus, rec.Body)
+				}
+				for _, reason := range tt.wantReasons {
+					if !strings.Contains(rec.Body.String(), reason) {
+						t.Errorf("%s: body %q doesn't give %q", path, rec.Body, reason)
+					}
+				}
+			}
+
+			// The roster pages keep working.
+			home := httptest.NewRecorder()
+			viewHomeHandler(home, httptest.NewRequest(http.MethodGet, "/", nil))
+			if home.Code != http.StatusOK {
+				t.Errorf("home page: status %d", home.Code)
+			}
+
+			rec := httptest.NewRecorder()
+			statusHandler(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+			var status ServerStatus
+			if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+				t.Fatal(err)
+			}
+			want := ServerStatus{Ready: true, Degraded: tt.wantReasons != nil, Disabled: tt.wantDisabled, Reasons: tt.wantReasons}
+			fetchedAt, err := time.Parse(time.RFC3339, status.RosterFetchedAt)
+			if err != nil || time.Since(fetchedAt) > time.Minute {
+				t.Errorf("roster fetched at %q, want the home page load", status.RosterFetchedAt)
+			}
+			status.RosterFetchedAt = ""
+			if !reflect.DeepEqual(status, want) {
+				t.Errorf("status %+v, want %+v", status, want)
+			}
+		})
+	}
+}
+
+func TestStatusBeforeTheFirstRoster(t *testing.T) {
+	serveRosterCsv(t, cardRoster)
+	wasReady := ready.Load()
+	ready.Store(false)
+	t.Cleanup(func() { ready.Store(wasReady) })
+
+	rec := httptest.NewRecorder()
+	statusHandler(rec, httptest.NewRequest(http.MethodGet, "/status", nil))
+	var status map[string]any
+	if err := json.NewDecoder(rec.Body).Decode(&status); err != nil {
+		t.Fatal(err)
+	}
+	if status["ready"] != false || status["roster_fetched_at"] != nil || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Errorf("status %v, Cache-Control %q, want not ready, no roster yet and no-store", status, rec.Header().Get("Cache-Control"))
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// gracePeriod reads GRACE_PERIOD, how long after expiring a member can still
+// renew, e.g. "720h". During it cards can still be issued and carry a renewal
+// banner. Unset means no grace period.
+func gracePeriod() (time.Duration, error) {
+	return durationFromEnv("GRACE_PERIOD", 0)
+}
+
+// graceEnd returns the end of a member's grace period. ok reports whether, on
+// now, the member is past expiration but still within it.
+func graceEnd(m Member, now time.Time) (end time.Time, ok bool, err error) {
+	grace, err := gracePeriod()
+	if err != nil || grace == 0 || m.ExpirationDate.IsZero() {
+		return time.Time{}, false, err
+	}
+	end = m.ExpirationDate.Add(grace)
+	inGrace := daysBetween(now, m.ExpirationDate) < 0 && daysBetween(now, end) >= 0
+	return end, inGrace, nil
+}
+
+func graceBanner(m Member, labels CardLabels, now time.Time) (TextModule, bool, error) {
+	end, ok, err := graceEnd(m, now)
+	if !ok {
+		return TextModule{}, false, err
+	}
+	return TextModule{
+		ID:     "grace_banner",
+		Header: labels.GraceBanner,
+		Body:   fmt.Sprintf(labels.GraceRenewBy, end.Format(labels.DateFormat)),
+	}, true, nil
+}
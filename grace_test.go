@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestCardStateAroundGrace(t *testing.T) {
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+	t.Setenv("GRACE_PERIOD", "720h")
+	now := date("2026-10-14")
+	tests := []struct {
+		name       string
+		expiration string
+		wantState  string
+		wantBanner bool
+	}{
+		{"current", "2026-12-31", "ACTIVE", false},
+		{"in grace", "2026-10-01", "ACTIVE", true},
+		{"last day of grace", "2026-09-14", "ACTIVE", true},
+		{"past grace", "2026-09-13", "EXPIRED", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card, err := newCardData(Member{ID: "a1", FirstName: "Jane", ExpirationDate: date(tt.expiration)}, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if card.State != tt.wantState {
+				t.Errorf("state = %s, want %s", card.State, tt.wantState)
+			}
+			if expired := card.Color == expiredCardColor; expired != (tt.wantState == "EXPIRED") {
+				t.Errorf("color = %s with state %s", card.Color, card.State)
+			}
+			banner := len(card.TextModules) > 0 && card.TextModules[0].ID == "grace_banner"
+			if banner != tt.wantBanner {
+				t.Errorf("grace banner shown: %v, want %v", banner, tt.wantBanner)
+			}
+		})
+	}
+}
+
+// googleCardPayload is the part of the rendered Google object the card
+// state tests look at.
+type googleCardPayload struct {
+	State     string `json:"state"`
+	Subheader struct {
+		DefaultValue struct {
+			Value string `json:"value"`
+		} `json:"defaultValue"`
+	} `json:"subheader"`
+	Color string `json:"hexBackgroundColor"`
+}
+
+func TestExpiredCardPolicy(t *testing.T) {
+	serveRosterCsv(t, cardRoster)
+	useSchema(t, apiSchema)
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+
+	tests := []struct {
+		policy     string
+		query      string
+		wantStatus int
+		wantState  string
+	}{
+		{"", "id=a2", http.StatusForbidden, ""},
+		{"refuse", "id=a2", http.StatusForbidden, ""},
+		{"issue", "id=a2", http.StatusOK, "EXPIRED"},
+		{"issue", "id=a1", http.StatusOK, "ACTIVE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+" "+tt.query, func(t *testing.T) {
+			t.Setenv("CARD_EXPIRED_POLICY", tt.policy)
+			rec := requestGoogleCard(t, tt.query)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantState == "" {
+				return
+			}
+			var card googleCardPayload
+			if err := json.Unmarshal(rec.Body.Bytes(), &card); err != nil {
+				t.Fatal(err)
+			}
+			expired := tt.wantState == "EXPIRED"
+			if card.State != tt.wantState {
+				t.Errorf("state = %s, want %s", card.State, tt.wantState)
+			}
+			if (card.Subheader.DefaultValue.Value == "EXPIRÉE") != expired || (card.Color == expiredCardColor) != expired {
+				t.Errorf("subheader %q and color %s on a %s card", card.Subheader.DefaultValue.Value, card.Color, card.State)
+			}
+		})
+	}
+}
+
+// Members inactive under ACTIVE_RULE before their expiration date get no
+// card, even when expired cards are issued.
+func TestExpiredCardPolicyKeepsTheActiveRule(t *testing.T) {
+	serveRosterCsv(t, cardRoster)
+	useSchema(t, apiSchema)
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+	t.Setenv("CARD_EXPIRED_POLICY", "issue")
+	t.Setenv("ACTIVE_RULE", "status=due")
+	if rec := requestGoogleCard(t, "id=a1"); rec.Code != http.StatusForbidden {
+		t.Errorf("status %d, want 403: %s", rec.Code, rec.Body)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const defaultHeroImage = "https://i.imgur.com/xA9F9ll.png"
+
+// validHttpsUrl accepts absolute https URLs, the only ones Wallet fetches or
+// links to.
+func validHttpsUrl(value string) bool {
+	parsed, err := url.Parse(value)
+	return err == nil && parsed.Scheme == "https" && parsed.Host != ""
+}
+
+// tierImages reads CARD_TIER_IMAGES, e.g. "gold=https://...,silver=https://...".
+func tierImages() (map[string]string, error) {
+	images := map[string]string{}
+	for _, entry := range splitList(os.Getenv("CARD_TIER_IMAGES"), ",") {
+		tier, image, found := strings.Cut(entry, "=")
+		image = strings.TrimSpace(image)
+		if !found || !validHttpsUrl(image) {
+			return nil, fmt.Errorf("CARD_TIER_IMAGES entry %q must look like tier=https://...", entry)
+		}
+		images[strings.ToLower(strings.TrimSpace(tier))] = image
+	}
+	return images, nil
+}
+
+// cardImageFallback reads CARD_IMAGE_FALLBACK, the ordered candidates for the
+// card image: a member field holding an image URL (e.g. "photo_url"), "tier"
+// for the CARD_TIER_IMAGES image of the member's tier, or a literal https URL
+// such as a program default or a generic logo.
+func cardImageFallback() ([]string, error) {
+	chain := splitList(os.Getenv("CARD_IMAGE_FALLBACK"), ",")
+	if len(chain) == 0 {
+		return []string{defaultHeroImage}, nil
+	}
+	for _, candidate := range chain {
+		if strings.Contains(candidate, "://") && !validHttpsUrl(candidate) {
+			return nil, fmt.Errorf("CARD_IMAGE_FALLBACK has an invalid image URL %q", candidate)
+		}
+	}
+	return chain, nil
+}
+
+// cardImageSource picks the first usable image of the fallback chain for a
+// member, skipping empty or invalid URLs, so the card is never left without
+// one. memberPhoto tells whether it came from a member field.
+func cardImageSource(m Member) (image string, memberPhoto bool, err error) {
+	chain, err := cardImageFallback()
+	if err != nil {
+		return "", false, err
+	}
+	tiers, err := tierImages()
+	if err != nil {
+		return "", false, err
+	}
+	for _, candidate := range chain {
+		var image string
+		switch {
+		case strings.Contains(candidate, "://"):
+			image = candidate
+		case candidate == "tier":
+			image = tiers[strings.ToLower(m.Extra["tier"])]
+		default:
+			image = m.Extra[candidate]
+			memberPhoto = true
+		}
+		if validHttpsUrl(image) {
+			return image, memberPhoto, nil
+		}
+		memberPhoto = false
+	}
+	return defaultHeroImage, false, nil
+}
+
+// cardImage is the image URL put on the card: member photos go through the
+// photo proxy when it is enabled.
+func cardImage(m Member) (string, error) {
+	image, memberPhoto, err := cardImageSource(m)
+	if err != nil || !memberPhoto {
+		return image, err
+	}
+	base, err := photoProxyBaseUrl()
+	if err != nil || base == "" {
+		return image, err
+	}
+	return base + "/photo/" + url.PathEscape(m.ID), nil
+}
@@ -0,0 +1,76 @@
+package main
+
+import "testing"
+
+func TestCardImageFallbackChain(t *testing.T) {
+	const (
+		photo   = "https://photos.example/jane.jpg"
+		gold    = "https://images.example/gold.png"
+		program = "https://images.example/program.png"
+		logo    = "https://images.example/logo.png"
+	)
+	chain := "photo_url,tier," + program + "," + logo
+	tiers := "gold=" + gold + ", silver=https://images.example/silver.png"
+	tests := []struct {
+		name            string
+		chain           string
+		extra           map[string]string
+		want            string
+		wantMemberPhoto bool
+	}{
+		{"member photo", chain, map[string]string{"photo_url": photo, "tier": "gold"}, photo, true},
+		{"tier image without a photo", chain, map[string]string{"tier": "Gold"}, gold, false},
+		{"tier image past an invalid photo", chain, map[string]string{"photo_url": "http://photos.example/jane.jpg", "tier": "gold"}, gold, false},
+		{"program default for an unknown tier", chain, map[string]string{"tier": "bronze"}, program, false},
+		{"program default without attributes", chain, nil, program, false},
+		{"generic logo last", "photo_url,tier," + logo, nil, logo, false},
+		{"built-in image when nothing resolves", "photo_url,tier", nil, defaultHeroImage, false},
+		{"built-in image without a chain", "", map[string]string{"photo_url": photo}, defaultHeroImage, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CARD_IMAGE_FALLBACK", tt.chain)
+			t.Setenv("CARD_TIER_IMAGES", tiers)
+			image, memberPhoto, err := cardImageSource(Member{ID: "a1", Extra: tt.extra})
+			if err != nil || image != tt.want || memberPhoto != tt.wantMemberPhoto {
+				t.Errorf("cardImageSource() = %q, %v, %v, want %q, %v", image, memberPhoto, err, tt.want, tt.wantMemberPhoto)
+			}
+		})
+	}
+}
+
+func TestCardImageFallbackValidation(t *testing.T) {
+	tests := []struct {
+		chain, tiers string
+	}{
+		{"photo_url,http://images.example/logo.png", ""},
+		{"https://", ""},
+		{"tier", "gold"},
+		{"tier", "gold=http://images.example/gold.png"},
+	}
+	for _, tt := range tests {
+		t.Setenv("CARD_IMAGE_FALLBACK", tt.chain)
+		t.Setenv("CARD_TIER_IMAGES", tt.tiers)
+		if image, _, err := cardImageSource(Member{}); err == nil {
+			t.Errorf("CARD_IMAGE_FALLBACK %q, CARD_TIER_IMAGES %q: got %q, want an error", tt.chain, tt.tiers, image)
+		}
+	}
+}
+
+// Member photos go through the photo proxy, other images don't.
+func TestCardImageUsesPhotoProxy(t *testing.T) {
+	t.Setenv("CARD_IMAGE_FALLBACK", "photo_url,https://images.example/logo.png")
+	t.Setenv("PHOTO_PROXY_BASE_URL", "https://cards.example/")
+	tests := []struct {
+		extra map[string]string
+		want  string
+	}{
+		{map[string]string{"photo_url": "https://photos.example/jane.jpg"}, "https://cards.example/photo/a%201"},
+		{nil, "https://images.example/logo.png"},
+	}
+	for _, tt := range tests {
+		if got, err := cardImage(Member{ID: "a 1", Extra: tt.extra}); err != nil || got != tt.want {
+			t.Errorf("cardImage() = %q, %v, want %q", got, err, tt.want)
+		}
+	}
+}
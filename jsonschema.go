@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// jsonSchemaBuilder derives a JSON Schema from Go types and their json tags,
+// so the published schema can't drift from what the API encodes. Structs
+// are described once under $defs and referenced.
+type jsonSchemaBuilder struct {
+	defs map[string]any
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (b *jsonSchemaBuilder) schema(t reflect.Type) map[string]any {
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t.Kind() == reflect.Pointer:
+		return b.schema(t.Elem())
+	case t.Kind() == reflect.String:
+		return map[string]any{"type": "string"}
+	case t.Kind() == reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		return map[string]any{"type": "number"}
+	case t.Kind() == reflect.Slice:
+		return map[string]any{"type": "array", "items": b.schema(t.Elem())}
+	case t.Kind() == reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case t.Kind() == reflect.Struct:
+		if _, ok := b.defs[t.Name()]; !ok {
+			b.defs[t.Name()] = nil
+			b.defs[t.Name()] = b.object(t)
+		}
+		return map[string]any{"$ref": "#/$defs/" + t.Name()}
+	}
+	return map[string]any{}
+}
+
+func (b *jsonSchemaBuilder) object(t reflect.Type) map[string]any {
+	properties := map[string]any{}
+	required := []string{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = b.schema(field.Type)
+		if !strings.Contains(options, "omitempty") {
+			required = append(required, name)
+		}
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"required":             required,
+		"additionalProperties": false,
+	}
+}
+
+// membersJsonSchema describes the /api/members response, with the member
+// record under $defs.Member.
+func membersJsonSchema() map[string]any {
+	b := &jsonSchemaBuilder{defs: map[string]any{}}
+	b.schema(reflect.TypeOf(Member{}))
+	root := b.object(reflect.TypeOf(MembersResponse{}))
+	root["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	root["$id"] = "/schema/member.json"
+	root["title"] = "MembersResponse"
+	root["$defs"] = b.defs
+	return root
+}
+
+func memberSchemaHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/schema+json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(membersJsonSchema()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validateJsonSchema checks a decoded JSON value against the subset of JSON
+// Schema the builder emits: type, properties, required,
+// additionalProperties, items, $ref and the date-time format.
+func validateJsonSchema(root, schema map[string]any, value any, path string) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		name := strings.TrimPrefix(ref, "#/$defs/")
+		def, ok := root["$defs"].(map[string]any)[name].(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: unknown $ref %q", path, ref)
+		}
+		return validateJsonSchema(root, def, value, path)
+	}
+	switch schema["type"] {
+	case "string":
+		text, ok := value.(string)
+		if !ok {
+			return fmt.Errorf("%s: want a string, got %T", path, value)
+		}
+		if schema["format"] == "date-time" {
+			if _, err := time.Parse(time.RFC3339, text); err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+		}
+	case "boolean":
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("%s: want a boolean, got %T", path, value)
+		}
+	case "integer", "number":
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s: want a number, got %T", path, value)
+		}
+	case "array":
+		items, ok := value.([]any)
+		if !ok {
+			return fmt.Errorf("%s: want an array, got %T", path, value)
+		}
+		for i, item := range items {
+			if err := validateJsonSchema(root, schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		object, ok := value.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: want an object, got %T", path, value)
+		}
+		required, _ := schema["required"].([]any)
+		for _, name := range required {
+			if _, ok := object[name.(string)]; !ok {
+				return fmt.Errorf("%s: missing required %q", path, name)
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for name, field := range object {
+			fieldSchema, ok := properties[name].(map[string]any)
+			if !ok {
+				fieldSchema, ok = schema["additionalProperties"].(map[string]any)
+			}
+			if !ok {
+				return fmt.Errorf("%s: unexpected property %q", path, name)
+			}
+			if err := validateJsonSchema(root, fieldSchema, field, path+"."+name); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("%s: unsupported schema %v", path, schema)
+	}
+	return nil
+}
+
+// servedMemberSchema fetches the schema the way integrators do, from
+// /schema/member.json.
+func servedMemberSchema(t *testing.T) map[string]any {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	memberSchemaHandler(recorder, httptest.NewRequest("GET", "/schema/member.json", nil))
+	var schema map[string]any
+	if err := json.Unmarshal(recorder.Body.Bytes(), &schema); err != nil {
+		t.Fatalf("decoding served schema: %v", err)
+	}
+	return schema
+}
+
+func TestMembersResponseMatchesJsonSchema(t *testing.T) {
+	joined := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		response MembersResponse
+	}{
+		{"empty", MembersResponse{Members: []Member{}}},
+		{"minimal member", MembersResponse{Members: []Member{{ID: "a1", FirstName: "Ada"}}}},
+		{"full member", MembersResponse{
+			Members: []Member{{
+				ID:             "b2",
+				Title:          "Dr",
+				FirstName:      "Grace",
+				LastName:       "Hopper",
+				Suffix:         "PhD",
+				Email:          "grace@example.org",
+				Language:       "en",
+				JoinDate:       joined,
+				MemberSince:    joined,
+				ExpirationDate: joined.AddDate(1, 0, 0),
+				Extra:          map[string]string{"phone": "0601020304"},
+				Lists:          map[string][]string{"roles": {"board", "treasurer"}},
+			}},
+			Snapshot: "0123abcd",
+			Next:     "/api/members?limit=1&offset=1&snapshot=0123abcd",
+		}},
+	}
+
+	schema := servedMemberSchema(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := json.Marshal(tt.response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded any
+			if err := json.Unmarshal(encoded, &decoded); err != nil {
+				t.Fatal(err)
+			}
+			if err := validateJsonSchema(schema, schema, decoded, "$"); err != nil {
+				t.Errorf("%s does not validate: %v", encoded, err)
+			}
+		})
+	}
+}
+
+// TestJsonSchemaCoversMemberFields fails when a Member field is added that
+// the schema doesn't describe, or the other way around.
+func TestJsonSchemaCoversMemberFields(t *testing.T) {
+	schema := servedMemberSchema(t)
+	member := schema["$defs"].(map[string]any)["Member"].(map[string]any)
+	var described []string
+	for name := range member["properties"].(map[string]any) {
+		described = append(described, name)
+	}
+
+	encoded, err := json.Marshal(Member{
+		Title:    "x",
+		Suffix:   "x",
+		Language: "x",
+		Extra:    map[string]string{"x": "x"},
+		Lists:    map[string][]string{"x": {"x"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		t.Fatal(err)
+	}
+	var encodedNames []string
+	for name := range fields {
+		encodedNames = append(encodedNames, name)
+	}
+
+	sort.Strings(described)
+	sort.Strings(encodedNames)
+	if strings.Join(described, ",") != strings.Join(encodedNames, ",") {
+		t.Errorf("schema describes %v, Member encodes %v", described, encodedNames)
+	}
+}
+
+func TestJsonSchemaRejectsUnknownProperties(t *testing.T) {
+	schema := servedMemberSchema(t)
+	var decoded any
+	if err := json.Unmarshal([]byte(`{"members":[{"id":"a","first_name":"","last_name":"","email":"","join_date":"0001-01-01T00:00:00Z","member_since":"0001-01-01T00:00:00Z","expiration_date":"0001-01-01T00:00:00Z","nickname":"x"}]}`), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if err := validateJsonSchema(schema, schema, decoded, "$"); err == nil {
+		t.Error("a member with an undeclared property validated")
+	}
+}
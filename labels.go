@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// CardLabels holds the card strings for one language. Day counts are
+// formatted into DaysLeft and DaysExpired, and card dates use DateFormat.
+type CardLabels struct {
+	Locale       string
+	DateFormat   string
+	Member       string
+	Name         string
+	MemberSince  string
+	ValidUntil   string
+	Validity     string
+	Unlimited    string
+	DaysLeft     string
+	OneDayLeft   string
+	ExpiresToday string
+	OneDayAgo    string
+	DaysExpired  string
+	GraceBanner  string
+	GraceRenewBy string
+	Terms        string
+	Privacy      string
+	Expired      string
+	Support      string
+	SupportText  string
+}
+
+var cardLabels = map[string]CardLabels{
+	"fr": {
+		Locale:       "fr-FR",
+		DateFormat:   "02/01/2006",
+		Member:       "Membre",
+		Name:         "Nom",
+		MemberSince:  "Membre depuis",
+		ValidUntil:   "Valide jusqu’au",
+		Validity:     "Validité",
+		Unlimited:    "Illimitée",
+		DaysLeft:     "Encore %d jours",
+		OneDayLeft:   "Encore 1 jour",
+		ExpiresToday: "Expire ce soir",
+		OneDayAgo:    "Expirée depuis 1 jour",
+		DaysExpired:  "Expirée depuis %d jours",
+		GraceBanner:  "Renouvelez maintenant — période de grâce",
+		GraceRenewBy: "Renouvelez avant le %s pour rester membre",
+		Terms:        "Conditions d’utilisation",
+		Privacy:      "Politique de confidentialité",
+		Expired:      "EXPIRÉE",
+		Support:      "Informations",
+		SupportText:  "Votre fiche adhérent est incomplète, contactez le bureau",
+	},
+	"en": {
+		Locale:       "en-US",
+		DateFormat:   "01/02/2006",
+		Member:       "Member",
+		Name:         "Name",
+		MemberSince:  "Member since",
+		ValidUntil:   "Valid until",
+		Validity:     "Validity",
+		Unlimited:    "Lifetime",
+		DaysLeft:     "Valid for %d more days",
+		OneDayLeft:   "Valid for 1 more day",
+		ExpiresToday: "Expires tonight",
+		OneDayAgo:    "Expired 1 day ago",
+		DaysExpired:  "Expired %d days ago",
+		GraceBanner:  "Renew now — grace period",
+		GraceRenewBy: "Renew by %s to stay a member",
+		Terms:        "Terms of use",
+		Privacy:      "Privacy policy",
+		Expired:      "EXPIRED",
+		Support:      "Information",
+		SupportText:  "Your member record is incomplete, please contact the office",
+	},
+}
+
+func cardDefaultLanguage() (string, error) {
+	language := os.Getenv("CARD_DEFAULT_LANGUAGE")
+	if language == "" {
+		return "fr", nil
+	}
+	if _, ok := cardLabels[language]; !ok {
+		return "", fmt.Errorf("CARD_DEFAULT_LANGUAGE %q has no card labels", language)
+	}
+	return language, nil
+}
+
+// labelsFor returns the card labels for a member's preferred language,
+// matching "en-GB" to "en", and falling back to the program default.
+// CARD_DATE_FORMAT, a Go time layout such as "2 Jan 2006", replaces the
+// date format of every language on cards; the admin UI is not affected.
+func labelsFor(language string) (CardLabels, error) {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if base, _, found := strings.Cut(language, "-"); found {
+		language = base
+	}
+	labels, ok := cardLabels[language]
+	if !ok {
+		fallback, err := cardDefaultLanguage()
+		if err != nil {
+			return CardLabels{}, err
+		}
+		labels = cardLabels[fallback]
+	}
+	if format := os.Getenv("CARD_DATE_FORMAT"); format != "" {
+		labels.DateFormat = format
+	}
+	return labels, nil
+}
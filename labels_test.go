@@ -0,0 +1,123 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// googleCardLabels is the localized part of the rendered Google object.
+type googleCardLabels struct {
+	Subheader struct {
+		DefaultValue struct {
+			Language string `json:"language"`
+			Value    string `json:"value"`
+		} `json:"defaultValue"`
+	} `json:"subheader"`
+	TextModules []struct {
+		ID     string `json:"id"`
+		Header string `json:"header"`
+	} `json:"textModulesData"`
+}
+
+// Members of one roster get their cards in their own language, and the
+// program default when theirs has no labels.
+func TestCardsFollowMemberLanguage(t *testing.T) {
+	serveRosterCsv(t, `id,first_name,last_name,email,language,join_date
+a1,Jane,Doe,jane@example.com,en-GB,2026-03-01
+a2,Jean,Roe,jean@example.com,fr,2026-03-01
+a3,Hans,Poe,hans@example.com,de,2026-03-01
+`)
+	useSchema(t, `{"columns": [
+		{"name": "id", "header": "id", "type": "string"},
+		{"name": "first_name", "header": "first_name", "type": "string"},
+		{"name": "last_name", "header": "last_name", "type": "string"},
+		{"name": "email", "header": "email", "type": "email"},
+		{"name": "language", "header": "language", "type": "string"},
+		{"name": "join_date", "header": "join_date", "type": "date"}
+	]}`)
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+
+	tests := []struct {
+		id              string
+		defaultLanguage string
+		wantLocale      string
+		wantSubheader   string
+		wantValidUntil  string
+	}{
+		{"a1", "", "en-US", "Member", "Valid until"},
+		{"a2", "", "fr-FR", "Membre", "Valide jusqu’au"},
+		{"a3", "", "fr-FR", "Membre", "Valide jusqu’au"},
+		{"a3", "en", "en-US", "Member", "Valid until"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.id+" "+tt.defaultLanguage, func(t *testing.T) {
+			t.Setenv("CARD_DEFAULT_LANGUAGE", tt.defaultLanguage)
+			rec := requestGoogleCard(t, "id="+tt.id)
+			var card googleCardLabels
+			if err := json.NewDecoder(rec.Body).Decode(&card); err != nil {
+				t.Fatalf("status %d: %v", rec.Code, err)
+			}
+			if card.Subheader.DefaultValue.Language != tt.wantLocale || card.Subheader.DefaultValue.Value != tt.wantSubheader {
+				t.Errorf("subheader %+v, want %q in %s", card.Subheader.DefaultValue, tt.wantSubheader, tt.wantLocale)
+			}
+			var validUntil string
+			for _, module := range card.TextModules {
+				if module.ID == "expiration_date" {
+					validUntil = module.Header
+				}
+			}
+			if validUntil != tt.wantValidUntil {
+				t.Errorf("expiration header %q, want %q", validUntil, tt.wantValidUntil)
+			}
+		})
+	}
+}
+
+// CARD_DATE_FORMAT changes dates on cards only, the admin UI keeps its own.
+func TestCardDateFormatLeavesTheUi(t *testing.T) {
+	serveRosterCsv(t, cardRoster)
+	useSchema(t, apiSchema)
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+	tests := []struct {
+		format   string
+		wantCard string
+	}{
+		{"", "01/03/2027"},
+		{"2 Jan 2006", "1 Mar 2027"},
+		{"2006-01-02", "2027-03-01"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			t.Setenv("CARD_DATE_FORMAT", tt.format)
+			var card struct {
+				TextModules []struct {
+					ID   string `json:"id"`
+					Body string `json:"body"`
+				} `json:"textModulesData"`
+			}
+			rec := requestGoogleCard(t, "id=a1")
+			if err := json.NewDecoder(rec.Body).Decode(&card); err != nil {
+				t.Fatalf("status %d: %v", rec.Code, err)
+			}
+			var expiration string
+			for _, module := range card.TextModules {
+				if module.ID == "expiration_date" {
+					expiration = module.Body
+				}
+			}
+			if expiration != tt.wantCard {
+				t.Errorf("card expiration %q, want %q", expiration, tt.wantCard)
+			}
+
+			home := httptest.NewRecorder()
+			viewHomeHandler(home, httptest.NewRequest(http.MethodGet, "/", nil))
+			ui := home.Body.String()
+			if !strings.Contains(ui, "2027-03-01") || (tt.wantCard != "2027-03-01" && strings.Contains(ui, tt.wantCard)) {
+				t.Errorf("the admin UI doesn't show 2027-03-01 alone:\n%s", ui)
+			}
+		})
+	}
+}
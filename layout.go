@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// LayoutRegion is a place on the card that member fields can be put in, with
+// the number of fields the Wallet renders there.
+type LayoutRegion struct {
+	Name      string
+	MaxFields int
+}
+
+var layoutRegions = []LayoutRegion{
+	{Name: "header", MaxFields: 1},
+	{Name: "text", MaxFields: 10},
+}
+
+// regionMaxFields is the number of fields the Wallet renders in a region, 0
+// for unknown regions.
+func regionMaxFields(name string) int {
+	for _, region := range layoutRegions {
+		if region.Name == name {
+			return region.MaxFields
+		}
+	}
+	return 0
+}
+
+// FieldLayout maps each card region to the ordered member fields shown in it.
+type FieldLayout map[string][]string
+
+type TextModule struct {
+	ID     string
+	Header string
+	Body   string
+}
+
+// defaultFieldLayout shows the member name as the header and the expiration
+// text modules selected by CARD_EXPIRATION_DISPLAY.
+func defaultFieldLayout() (FieldLayout, error) {
+	display, err := cardExpirationDisplay()
+	if err != nil {
+		return nil, err
+	}
+	layout := FieldLayout{"header": {"name"}}
+	switch display {
+	case "date":
+		layout["text"] = []string{"expiration_date"}
+	case "countdown":
+		layout["text"] = []string{"countdown"}
+	default:
+		layout["text"] = []string{"expiration_date", "countdown"}
+	}
+	return layout, nil
+}
+
+// cardFieldLayout reads CARD_FIELD_LAYOUT, e.g.
+// "header=name;text=expiration_date,countdown,chapter". Regions left out keep
+// their default fields.
+func cardFieldLayout(schema *Schema) (FieldLayout, error) {
+	layout, err := defaultFieldLayout()
+	if err != nil {
+		return nil, err
+	}
+	value := os.Getenv("CARD_FIELD_LAYOUT")
+	if value == "" {
+		return layout, nil
+	}
+
+	known := filterableFields(schema)
+	known["name"] = true
+	known["countdown"] = true
+	for _, part := range strings.Split(value, ";") {
+		if strings.TrimSpace(part) == "" {
+			continue
+		}
+		region, list, found := strings.Cut(part, "=")
+		if !found {
+			return nil, fmt.Errorf("CARD_FIELD_LAYOUT entry %q must look like region=field,field", part)
+		}
+		region = strings.TrimSpace(region)
+		maxFields := regionMaxFields(region)
+		if maxFields == 0 {
+			return nil, fmt.Errorf("CARD_FIELD_LAYOUT has unknown region %q", region)
+		}
+		fields := splitList(list, ",")
+		for _, field := range fields {
+			if !known[field] {
+				return nil, fmt.Errorf("CARD_FIELD_LAYOUT has unknown field %q in region %q", field, region)
+			}
+		}
+		if len(fields) > maxFields {
+			return nil, fmt.Errorf("CARD_FIELD_LAYOUT puts %d fields in region %q, which shows at most %d", len(fields), region, maxFields)
+		}
+		layout[region] = fields
+	}
+	return layout, nil
+}
+
+func fieldHeader(field string, labels CardLabels) string {
+	switch field {
+	case "name":
+		return labels.Name
+	case "expiration_date":
+		return labels.ValidUntil
+	case "countdown":
+		return labels.Validity
+	case "join_date", "member_since":
+		return labels.MemberSince
+	case "email":
+		return "Email"
+	}
+	header := strings.ReplaceAll(field, "_", " ")
+	first, size := utf8.DecodeRuneInString(header)
+	return string(unicode.ToUpper(first)) + header[size:]
+}
+
+// fieldText renders a member field for display on the card. ok is false
+// when the field has nothing to show, like the countdown of a lifetime
+// membership.
+func fieldText(m Member, field string, labels CardLabels, now time.Time) (text string, ok bool) {
+	switch field {
+	case "name":
+		text = m.displayName()
+	case "expiration_date":
+		if m.ExpirationDate.IsZero() {
+			return labels.Unlimited, true
+		}
+		text = m.ExpirationDate.Format(labels.DateFormat)
+	case "countdown":
+		if m.ExpirationDate.IsZero() {
+			return "", false
+		}
+		text = expirationCountdown(m.ExpirationDate, now, labels)
+	case "join_date", "member_since":
+		if m.MemberSince.IsZero() {
+			return "", false
+		}
+		text = m.MemberSince.Format(labels.DateFormat)
+	default:
+		text = strings.Join(memberFieldValues(m, field), ", ")
+	}
+	return text, text != ""
+}
+
+func (layout FieldLayout) textModules(m Member, labels CardLabels, now time.Time) []TextModule {
+	var modules []TextModule
+	for _, field := range layout["text"] {
+		if text, ok := fieldText(m, field, labels, now); ok {
+			modules = append(modules, TextModule{ID: field, Header: fieldHeader(field, labels), Body: text})
+		}
+	}
+	return modules
+}
+
+func (layout FieldLayout) header(m Member, labels CardLabels, now time.Time) string {
+	var parts []string
+	for _, field := range layout["header"] {
+		if text, ok := fieldText(m, field, labels, now); ok {
+			parts = append(parts, text)
+		}
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFieldHeader(t *testing.T) {
+	labels := CardLabels{MemberSince: "Member since"}
+	tests := []struct {
+		field string
+		want  string
+	}{
+		{"member_since", "Member since"},
+		{"email", "Email"},
+		{"chapter", "Chapter"},
+		{"membership_tier", "Membership tier"},
+		{"éligibilité", "Éligibilité"},
+		{"ønske_dato", "Ønske dato"},
+		{"1st_aid", "1st aid"},
+	}
+	for _, tt := range tests {
+		if got := fieldHeader(tt.field, labels); got != tt.want {
+			t.Errorf("fieldHeader(%q) = %q, want %q", tt.field, got, tt.want)
+		}
+	}
+}
+
+// textModule returns the body of the card text module with the given id.
+func textModule(card CardData, id string) (string, bool) {
+	for _, module := range card.TextModules {
+		if module.ID == id {
+			return module.Body, true
+		}
+	}
+	return "", false
+}
+
+func TestCardCountdown(t *testing.T) {
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+	t.Setenv("GRACE_PERIOD", "720h")
+	now := date("2026-10-14")
+	tests := []struct {
+		name       string
+		language   string
+		expiration time.Time
+		want       string
+		wantShown  bool
+	}{
+		{"current", "en", date("2027-09-21"), "Valid for 342 more days", true},
+		{"last day but one", "en", date("2026-10-15"), "Valid for 1 more day", true},
+		{"last day", "en", now, "Expires tonight", true},
+		{"in grace", "en", date("2026-10-13"), "Expired 1 day ago", true},
+		{"expired", "en", date("2026-08-01"), "Expired 74 days ago", true},
+		{"current, in French", "fr", date("2027-09-21"), "Encore 342 jours", true},
+		{"expired, in French", "fr", date("2026-08-01"), "Expirée depuis 74 jours", true},
+		{"lifetime", "en", time.Time{}, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card, err := newCardData(Member{ID: "a1", FirstName: "Jane", Language: tt.language, ExpirationDate: tt.expiration}, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, shown := textModule(card, "countdown")
+			if got != tt.want || shown != tt.wantShown {
+				t.Errorf("countdown = %q (shown: %v), want %q (shown: %v)", got, shown, tt.want, tt.wantShown)
+			}
+		})
+	}
+}
+
+func TestCardExpirationDisplay(t *testing.T) {
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+	member := Member{ID: "a1", FirstName: "Jane", Language: "en", ExpirationDate: date("2026-12-31")}
+	tests := []struct {
+		display       string
+		wantDate      bool
+		wantCountdown bool
+	}{
+		{"", true, true},
+		{"both", true, true},
+		{"date", true, false},
+		{"countdown", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.display, func(t *testing.T) {
+			t.Setenv("CARD_EXPIRATION_DISPLAY", tt.display)
+			card, err := newCardData(member, date("2026-10-14"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, shown := textModule(card, "expiration_date"); shown != tt.wantDate {
+				t.Errorf("expiration date shown: %v, want %v", shown, tt.wantDate)
+			}
+			if _, shown := textModule(card, "countdown"); shown != tt.wantCountdown {
+				t.Errorf("countdown shown: %v, want %v", shown, tt.wantCountdown)
+			}
+		})
+	}
+}
+
+func TestProgramStartCapsMemberSince(t *testing.T) {
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+	t.Setenv("CARD_FIELD_LAYOUT", "text=member_since")
+	now := date("2026-10-14")
+	tests := []struct {
+		name        string
+		start       string
+		memberSince time.Time
+		want        string
+		wantErr     bool
+	}{
+		{"no program start", "", date("1990-05-12"), "12/05/1990", false},
+		{"joined before the program", "2010-09-01", date("1990-05-12"), "01/09/2010", false},
+		{"joined on the program start", "2010-09-01", date("2010-09-01"), "01/09/2010", false},
+		{"joined after the program", "2010-09-01", date("2015-02-03"), "03/02/2015", false},
+		{"invalid program start", "2010", date("1990-05-12"), "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PROGRAM_START", tt.start)
+			card, err := newCardData(Member{ID: "a1", FirstName: "Jane", MemberSince: tt.memberSince, ExpirationDate: date("2026-12-31")}, now)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("newCardData() succeeded, want an invalid PROGRAM_START")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got, _ := textModule(card, "member_since"); got != tt.want {
+				t.Errorf("member since %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// The roster keeps the real date, only cards are capped.
+func TestProgramStartLeavesTheRoster(t *testing.T) {
+	serveRosterCsv(t, "id,first_name,last_name,email,member_since,join_date\na1,Jane,Doe,jane@example.com,1990-05-12,2026-03-01\n")
+	useSchema(t, `{"columns": [
+		{"name": "id", "header": "id", "type": "string"},
+		{"name": "first_name", "header": "first_name", "type": "string"},
+		{"name": "last_name", "header": "last_name", "type": "string"},
+		{"name": "email", "header": "email", "type": "email"},
+		{"name": "member_since", "header": "member_since", "type": "date"},
+		{"name": "join_date", "header": "join_date", "type": "date"}
+	]}`)
+	t.Setenv("PROGRAM_START", "2010-09-01")
+	page := getMembersPage(t, "/api/members")
+	if len(page.Members) != 1 || page.Members[0].MemberSince.Format("2006-01-02") != "1990-05-12" {
+		t.Errorf("roster members %+v, want Jane a member since 1990-05-12", page.Members)
+	}
+}
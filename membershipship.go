@@ -1,26 +1,77 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
 	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
-	"html/template"
+	"hash"
+	"io"
 	"log"
 	"net/http"
 	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
 type Member struct {
-	FirstName      string
-	LastName       string
-	Email          string
-	JoinDate       time.Time
-	ExpirationDate time.Time
+	ID             string              `json:"id"`
+	Title          string              `json:"title,omitempty"`
+	FirstName      string              `json:"first_name"`
+	LastName       string              `json:"last_name"`
+	Suffix         string              `json:"suffix,omitempty"`
+	Email          string              `json:"email"`
+	Language       string              `json:"language,omitempty"`
+	JoinDate       time.Time           `json:"join_date"`
+	MemberSince    time.Time           `json:"member_since"`
+	ExpirationDate time.Time           `json:"expiration_date"`
+	Extra          map[string]string   `json:"extra,omitempty"`
+	Lists          map[string][]string `json:"lists,omitempty"`
 }
 
 type Page struct {
 	Members []Member
+	GroupBy string
+	Groups  []Group
+}
+
+// Group is a section of the member list, for ?group_by= on the home page.
+type Group struct {
+	Name    string
+	Members []Member
+}
+
+// groupMembers sections members by a field, the membership field included,
+// keeping their order within each section. Sections are sorted by
+// name, with members that have no value for the field last.
+func groupMembers(members []Member, field string, rule activeRule, now time.Time) []Group {
+	var groups []Group
+	index := map[string]int{}
+	for _, member := range members {
+		name := strings.Join(ruledFieldValues(member, field, rule, now), ", ")
+		i, ok := index[name]
+		if !ok {
+			i = len(groups)
+			index[name] = i
+			groups = append(groups, Group{Name: name})
+		}
+		groups[i].Members = append(groups[i].Members, member)
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if (groups[i].Name == "") != (groups[j].Name == "") {
+			return groups[j].Name == ""
+		}
+		return groups[i].Name < groups[j].Name
+	})
+	return groups
 }
 
 const baseUrl = "https://walletobjects.googleapis.com/walletobjects/v1"
@@ -41,14 +92,82 @@ func googleClassId() (string, error) {
 	return classId, nil
 }
 
+// googleObjectId is the Wallet object ID of a member's card: the issuer ID
+// that prefixes GOOGLE_CLASS_ID, then the member ID, or a hash of it when it
+// holds characters Wallet doesn't accept.
+func googleObjectId(classId string, m Member) (string, error) {
+	issuer, _, found := strings.Cut(classId, ".")
+	if !found || issuer == "" {
+		return "", fmt.Errorf("GOOGLE_CLASS_ID must look like ISSUER_ID.CLASS_SUFFIX, got %q", classId)
+	}
+	suffix := m.ID
+	if strings.IndexFunc(suffix, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-')
+	}) >= 0 {
+		sum := sha256.Sum256([]byte(m.ID))
+		suffix = "member-" + hex.EncodeToString(sum[:16])
+	}
+	return issuer + "." + suffix, nil
+}
+
+func durationFromEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("%s is not a valid duration: %v", name, err)
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("%s must be a positive duration, got %s", name, value)
+	}
+	return duration, nil
+}
+
+// The CSV export can be large and slow while lookups made for a card should
+// answer quickly, so each outbound destination gets its own timeout:
+// CSV_FETCH_TIMEOUT (default 60s) for the roster download, JSON_API_TIMEOUT
+// (60s) for each roster API page, BILLING_API_TIMEOUT (5s) for each billing
+// lookup and PHOTO_FETCH_TIMEOUT (10s) for each member photo.
+func outboundClient(variable string, fallback time.Duration) (*http.Client, error) {
+	timeout, err := durationFromEnv(variable, fallback)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Client{Timeout: timeout}, nil
+}
+
+// twoDigitYearPivot reads TWO_DIGIT_YEAR_PIVOT (default 30): two-digit years
+// below it are in the 2000s, the others in the 1900s.
+func twoDigitYearPivot() (int, error) {
+	value := os.Getenv("TWO_DIGIT_YEAR_PIVOT")
+	if value == "" {
+		return 30, nil
+	}
+	pivot, err := strconv.Atoi(value)
+	if err != nil || pivot < 0 || pivot > 100 {
+		return 0, fmt.Errorf("TWO_DIGIT_YEAR_PIVOT must be a number from 0 to 100, got %q", value)
+	}
+	return pivot, nil
+}
+
 func parseDate(dateStr string) (time.Time, error) {
 	layouts := []string{
 		"02/01/2006", // DD/MM/YYYY
+		"2006-01-02", // YYYY-MM-DD, as APIs send them
 		"2/1/2006",   // D/M/YYYY
 		"1/2/2006",   // M/D/YYYY
 		"02/1/2006",  // DD/M/YYYY
 		"2/01/2006",  // D/MM/YYYY
 	}
+	// Legacy exports with two-digit years, only tried once the layouts
+	// above have failed.
+	shortLayouts := []string{
+		"02/01/06", // DD/MM/YY
+		"2/1/06",   // D/M/YY
+		"1/2/06",   // M/D/YY
+	}
 
 	dateStr = strings.TrimSpace(dateStr)
 
@@ -57,123 +176,856 @@ func parseDate(dateStr string) (time.Time, error) {
 			return parsedTime, nil
 		}
 	}
+	for _, layout := range shortLayouts {
+		if parsedTime, err := time.Parse(layout, dateStr); err == nil {
+			pivot, err := twoDigitYearPivot()
+			if err != nil {
+				return time.Time{}, err
+			}
+			year := parsedTime.Year() % 100
+			if year < pivot {
+				year += 2000
+			} else {
+				year += 1900
+			}
+			// 29/02/00 is a date in 2000 but not in 1900, which isn't a leap
+			// year.
+			date := time.Date(year, parsedTime.Month(), parsedTime.Day(), 0, 0, 0, 0, time.UTC)
+			if date.Day() != parsedTime.Day() {
+				return time.Time{}, fmt.Errorf("unable to parse date: %s, there is no %s in %d", dateStr, parsedTime.Format("January 2"), year)
+			}
+			return date, nil
+		}
+	}
 
 	return time.Time{}, fmt.Errorf("unable to parse date: %s", dateStr)
 }
 
-func readCSVFromUrl(url string) ([]Member, error) {
-	resp, err := http.Get(url)
+// csvChecksumUrl builds the checksum sidecar URL from CSV_CHECKSUM_URL, where
+// "{url}" stands for the CSV URL (e.g. "{url}.sha256"). Verification is
+// disabled when it is unset.
+func csvChecksumUrl(csvUrl string) string {
+	pattern := os.Getenv("CSV_CHECKSUM_URL")
+	if pattern == "" {
+		return ""
+	}
+	return strings.ReplaceAll(pattern, "{url}", csvUrl)
+}
+
+// fetchChecksum reads the hex digest from a checksum sidecar, in the format
+// of sha256sum: the digest optionally followed by the file name.
+func fetchChecksum(client *http.Client, checksumUrl string) (string, error) {
+	resp, err := getUrl(client, checksumUrl)
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("error fetching CSV checksum: %v", err)
 	}
 	defer resp.Body.Close()
-	reader := csv.NewReader(resp.Body)
-	reader.Comma = ','
-	data, err := reader.ReadAll()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("error fetching CSV checksum: %s", resp.Status)
+	}
+	sidecar, err := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("error reading CSV checksum: %v", err)
+	}
+	fields := strings.Fields(string(sidecar))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("CSV checksum file %s is empty", checksumUrl)
 	}
+	return fields[0], nil
+}
 
-	var members []Member
-	for i, row := range data {
-		if i == 0 || len(row) < 6 { // Skip header row and ensure row has enough columns
-			continue
-		}
-		joinDate, err := parseDate(row[5]) // Assuming join date is in column 6
-		if err != nil {
-			panic(fmt.Errorf("Error parsing join date for row %d: %v", i, err))
+// checksumReader hashes the CSV while it is parsed and fails the last read
+// when the digest doesn't match the sidecar, so a corrupt download ends the
+// parse with an error and the previous good roster is kept.
+type checksumReader struct {
+	body     io.ReadCloser
+	hash     hash.Hash
+	expected string
+}
+
+func (r *checksumReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	r.hash.Write(p[:n])
+	if err == io.EOF {
+		if actual := hex.EncodeToString(r.hash.Sum(nil)); !strings.EqualFold(r.expected, actual) {
+			return n, fmt.Errorf("CSV checksum mismatch: expected %s, got %s", r.expected, actual)
 		}
-		member := Member{
-			FirstName:      strings.TrimSpace(row[1]),
-			LastName:       strings.TrimSpace(row[2]),
-			Email:          strings.TrimSpace(row[3]),
-			JoinDate:       joinDate,
-			ExpirationDate: joinDate.AddDate(1, 0, 0), // Add 1 year to join date
+	}
+	return n, err
+}
+
+func (r *checksumReader) Close() error {
+	return r.body.Close()
+}
+
+// fetchCSV downloads the roster CSV, from the web or from an s3:// or gs://
+// bucket, verifying its checksum sidecar when one is configured.
+func fetchCSV(url string) (io.ReadCloser, error) {
+	client, err := outboundClient("CSV_FETCH_TIMEOUT", 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	expected := ""
+	if checksumUrl := csvChecksumUrl(url); checksumUrl != "" {
+		if expected, err = fetchChecksum(client, checksumUrl); err != nil {
+			return nil, err
 		}
-		members = append(members, member)
 	}
-	return members, nil
+	resp, err := getUrl(client, url)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error fetching CSV: %s", resp.Status)
+	}
+	if expected == "" {
+		return resp.Body, nil
+	}
+	return &checksumReader{body: resp.Body, hash: sha256.New(), expected: expected}, nil
+}
+
+func csvParseTimeout() (time.Duration, error) {
+	return durationFromEnv("CSV_PARSE_TIMEOUT", 0)
+}
+
+func parseCSV(ctx context.Context, body io.Reader) (ParseResult, error) {
+	reader := csv.NewReader(body)
+	reader.Comma = ','
+	reader.ReuseRecord = true
+	// Short rows are reported by parseRoster, row by row, rather than ending
+	// the parse.
+	reader.FieldsPerRecord = -1
+	schema, err := csvSchema()
+	if err != nil {
+		return ParseResult{}, err
+	}
+	return parseRoster(ctx, reader, schema)
+}
+
+func readCSVFromUrl(url string) ([]Member, error) {
+	body, err := fetchCSV(url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	ctx := context.Background()
+	timeout, err := csvParseTimeout()
+	if err != nil {
+		return nil, err
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	// A truncated roster is not served: the last good one is better than a
+	// partial one.
+	result, err := parseCSV(ctx, body)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Errors) > 0 {
+		return nil, &result.Errors[0]
+	}
+	return result.Members, nil
+}
+
+// templateOutputLimit caps the size of a single template render, so a
+// runaway template fails cleanly instead of exhausting memory.
+func templateOutputLimit() (int, error) {
+	value := os.Getenv("TEMPLATE_OUTPUT_LIMIT")
+	if value == "" {
+		return 10 << 20, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("TEMPLATE_OUTPUT_LIMIT must be a positive number of bytes, got %q", value)
+	}
+	return limit, nil
+}
+
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if b.Len()+len(p) > b.limit {
+		return 0, fmt.Errorf("template output exceeds %d bytes", b.limit)
+	}
+	return b.Buffer.Write(p)
+}
+
+type executableTemplate interface {
+	Execute(w io.Writer, data any) error
+}
+
+// executeLimited renders a template into memory, aborting past
+// TEMPLATE_OUTPUT_LIMIT.
+func executeLimited(t executableTemplate, data any) ([]byte, error) {
+	limit, err := templateOutputLimit()
+	if err != nil {
+		return nil, err
+	}
+	output := &limitedBuffer{limit: limit}
+	if err := t.Execute(output, data); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
 }
 
 func renderHtmlTemplate(w http.ResponseWriter, tmpl string, p *Page) {
-	t, err := template.ParseFiles(tmpl + ".html")
+	t, err := htmlTemplate(tmpl + ".html")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	err = t.Execute(w, p)
+	output, err := executeLimited(t, p)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	w.Write(output)
 }
 
 func fetchMemberData() ([]Member, error) {
-	url := os.Getenv("CSV_URL")
-	if url == "" {
-		return nil, fmt.Errorf("CSV_URL environment variable is not set")
+	source, err := rosterSource()
+	if err != nil {
+		return nil, err
+	}
+	members, err := source.Members()
+	if err != nil {
+		return nil, err
 	}
-	return readCSVFromUrl(url)
+	return withBillingStatus(members)
 }
 
-func viewHomeHandler(w http.ResponseWriter, r *http.Request) {
-	p := &Page{}
+// lastGoodRoster keeps the last successfully parsed roster so a temporary
+// source failure doesn't take the whole UI down.
+var lastGoodRoster struct {
+	sync.Mutex
+	members   []Member
+	fetchedAt time.Time
+}
+
+// loadRoster fetches the roster, falling back to the last good one when the
+// fetch fails. stale reports whether the fallback was served.
+func loadRoster() (members []Member, stale bool, err error) {
+	members, err = fetchMemberData()
+	lastGoodRoster.Lock()
+	defer lastGoodRoster.Unlock()
+	if err == nil {
+		lastGoodRoster.members = members
+		lastGoodRoster.fetchedAt = time.Now()
+		return members, false, nil
+	}
+	if lastGoodRoster.fetchedAt.IsZero() {
+		return nil, false, err
+	}
+	maxStale, maxErr := maxStaleAge()
+	if maxErr != nil {
+		return nil, false, maxErr
+	}
+	if age := time.Since(lastGoodRoster.fetchedAt); maxStale > 0 && age > maxStale {
+		return nil, false, &staleRosterError{fetchedAt: lastGoodRoster.fetchedAt, err: err}
+	}
+	log.Printf("Error fetching member data, serving roster from %s: %v", lastGoodRoster.fetchedAt.Format(time.RFC3339), err)
+	return lastGoodRoster.members, true, nil
+}
+
+// maxStaleAge reads MAX_STALE, how old the last good roster may get before
+// it stops being served. Unset means no limit.
+func maxStaleAge() (time.Duration, error) {
+	return durationFromEnv("MAX_STALE", 0)
+}
+
+// staleRosterError reports a source failure when the last good roster is too
+// old to fall back to.
+type staleRosterError struct {
+	fetchedAt time.Time
+	err       error
+}
+
+func (e *staleRosterError) Error() string {
+	return fmt.Sprintf("roster source unavailable and last good roster from %s is older than MAX_STALE: %v", e.fetchedAt.Format(time.RFC3339), e.err)
+}
 
-	members, err := fetchMemberData()
+// rosterErrorStatus is 503 when only a too old roster is left, forcing
+// attention to the broken source, and 500 otherwise.
+func rosterErrorStatus(err error) int {
+	var staleErr *staleRosterError
+	if errors.As(err, &staleErr) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusInternalServerError
+}
+
+func setStaleWarning(w http.ResponseWriter) {
+	w.Header().Set("Warning", `110 - "Roster source unavailable, serving last good data"`)
+}
+
+// serveRoster loads the roster for a handler. ok is false when it couldn't and
+// the error response has already been written.
+func serveRoster(w http.ResponseWriter) (members []Member, ok bool) {
+	members, stale, err := loadRoster()
+	if err != nil {
+		http.Error(w, "Error fetching member data: "+err.Error(), rosterErrorStatus(err))
+		return nil, false
+	}
+	if stale {
+		setStaleWarning(w)
+	}
+	return members, true
+}
+
+func findMember(members []Member, id string) (Member, bool) {
+	for _, member := range members {
+		if member.ID == id {
+			return member, true
+		}
+	}
+	return Member{}, false
+}
+
+// viewMemberRowHandler renders a single member's table row, without the page
+// around it, so the admin UI can refresh one row after an edit.
+func viewMemberRowHandler(w http.ResponseWriter, r *http.Request) {
+	members, ok := serveRoster(w)
+	if !ok {
+		return
+	}
+	member, ok := findMember(members, r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	t, err := htmlTemplate("home.html")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	output, err := executeLimited(t.Lookup("member_row"), member)
 	if err != nil {
-		http.Error(w, "Error fetching member data: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Write(output)
+}
+
+func viewHomeHandler(w http.ResponseWriter, r *http.Request) {
+	p := &Page{GroupBy: r.URL.Query().Get("group_by")}
+	var rule activeRule
+	if p.GroupBy != "" {
+		schema, err := csvSchema()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		known := filterableFields(schema)
+		known[membershipField] = true
+		if !known[p.GroupBy] {
+			http.Error(w, fmt.Sprintf("unknown group_by field %q", p.GroupBy), http.StatusBadRequest)
+			return
+		}
+		if rule, err = loadActiveRule(schema); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	members, ok := serveRoster(w)
+	if !ok {
 		return
 	}
 
 	p.Members = members
+	if p.GroupBy != "" {
+		p.Groups = groupMembers(members, p.GroupBy, rule, time.Now())
+	}
 
 	renderHtmlTemplate(w, "home", p)
 }
 
-func renderJsonTemplate(firstName, lastName, expirationDate string) (string, error) {
-	templateFile := "./google_card.json"
-	templateBytes, err := os.ReadFile(templateFile)
+type CardData struct {
+	ObjectID       string
+	ClassID        string
+	State          string
+	Subheader      string
+	Header         string
+	Labels         CardLabels
+	TextModules    []TextModule
+	BarcodeType    string
+	BarcodeValue   string
+	PassExpiration string
+	HeroImage      string
+	Color          string
+	Links          []CardLink
+}
+
+// passExpiryBuffer keeps passes showing, in their expired state, for a while
+// after the membership itself lapses. Access control still uses
+// Member.ExpirationDate.
+func passExpiryBuffer() (time.Duration, error) {
+	return durationFromEnv("PASS_EXPIRY_BUFFER", 0)
+}
+
+func passExpiration(m Member) (string, error) {
+	if m.ExpirationDate.IsZero() {
+		return "", nil
+	}
+	buffer, err := passExpiryBuffer()
 	if err != nil {
-		return "", fmt.Errorf("error reading JSON template file: %v", err)
+		return "", err
+	}
+	return m.ExpirationDate.Add(buffer).Format(time.RFC3339), nil
+}
+
+// barcodeFormat names a barcode symbology on each wallet platform.
+type barcodeFormat struct {
+	Google string
+	Apple  string
+}
+
+var barcodeFormats = map[string]barcodeFormat{
+	"text":    {Google: "TEXT_ONLY"},
+	"qr":      {Google: "QR_CODE", Apple: "PKBarcodeFormatQR"},
+	"pdf417":  {Google: "PDF_417", Apple: "PKBarcodeFormatPDF417"},
+	"aztec":   {Google: "AZTEC", Apple: "PKBarcodeFormatAztec"},
+	"code128": {Google: "CODE_128", Apple: "PKBarcodeFormatCode128"},
+}
+
+func barcodeFormatFromEnv(name string, fallback barcodeFormat) (barcodeFormat, error) {
+	value := strings.ToLower(os.Getenv(name))
+	if value == "" {
+		return fallback, nil
+	}
+	format, ok := barcodeFormats[value]
+	if !ok {
+		return barcodeFormat{}, fmt.Errorf("%s must be one of text, qr, pdf417, aztec or code128, got %q", name, value)
+	}
+	return format, nil
+}
+
+// cardBarcodeFormat is the CARD_BARCODE_FORMAT used on cards: text (the
+// default, no scannable barcode), qr, pdf417, aztec or code128.
+// GOOGLE_BARCODE_FORMAT and APPLE_BARCODE_FORMAT override it for one
+// platform, so venues scanning Apple passes can get Code 128 while Google
+// cards keep a QR code.
+func cardBarcodeFormat() (barcodeFormat, error) {
+	shared, err := barcodeFormatFromEnv("CARD_BARCODE_FORMAT", barcodeFormats["text"])
+	if err != nil {
+		return barcodeFormat{}, err
+	}
+	google, err := barcodeFormatFromEnv("GOOGLE_BARCODE_FORMAT", shared)
+	if err != nil {
+		return barcodeFormat{}, err
+	}
+	apple, err := barcodeFormatFromEnv("APPLE_BARCODE_FORMAT", shared)
+	if err != nil {
+		return barcodeFormat{}, err
+	}
+	// Apple passes have no text-only barcode, they go without one by leaving
+	// it out, so asking for it explicitly is a mistake.
+	if apple.Apple == "" && os.Getenv("APPLE_BARCODE_FORMAT") != "" {
+		return barcodeFormat{}, fmt.Errorf("APPLE_BARCODE_FORMAT text is not supported by Apple Wallet, leave it unset for no barcode")
+	}
+	return barcodeFormat{Google: google.Google, Apple: apple.Apple}, nil
+}
+
+// cardExpirationDisplay tells which of the expiration date and the countdown
+// are shown on cards: "date", "countdown" or "both" (the default).
+func cardExpirationDisplay() (string, error) {
+	display := os.Getenv("CARD_EXPIRATION_DISPLAY")
+	switch display {
+	case "":
+		return "both", nil
+	case "date", "countdown", "both":
+		return display, nil
+	}
+	return "", fmt.Errorf("CARD_EXPIRATION_DISPLAY must be date, countdown or both, got %q", display)
+}
+
+func daysBetween(from, to time.Time) int {
+	from = time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	to = time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours() / 24)
+}
+
+func expirationCountdown(expirationDate, now time.Time, labels CardLabels) string {
+	days := daysBetween(now, expirationDate)
+	switch {
+	case days > 1:
+		return fmt.Sprintf(labels.DaysLeft, days)
+	case days == 1:
+		return labels.OneDayLeft
+	case days == 0:
+		return labels.ExpiresToday
+	case days == -1:
+		return labels.OneDayAgo
+	default:
+		return fmt.Sprintf(labels.DaysExpired, -days)
+	}
+}
+
+// programStart reads PROGRAM_START (YYYY-MM-DD), the founding date of the
+// program, if it is set.
+func programStart() (time.Time, error) {
+	value := os.Getenv("PROGRAM_START")
+	if value == "" {
+		return time.Time{}, nil
+	}
+	start, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("PROGRAM_START must be a YYYY-MM-DD date, got %q", value)
+	}
+	return start, nil
+}
+
+// cardDisplayMember is the member as shown on cards: members who joined
+// before the program existed, migrated from an older one, are shown as
+// members since the program start. The roster keeps their real join date.
+func cardDisplayMember(m Member) (Member, error) {
+	start, err := programStart()
+	if err != nil {
+		return Member{}, err
+	}
+	if !m.MemberSince.IsZero() && m.MemberSince.Before(start) {
+		m.MemberSince = start
+	}
+	return m, nil
+}
+
+// newCardData prepares the card template data, placing member fields as
+// configured by the card field layout.
+func newCardData(m Member, now time.Time) (CardData, error) {
+	labels, err := labelsFor(m.Language)
+	if err != nil {
+		return CardData{}, err
+	}
+	barcode, err := cardBarcodeFormat()
+	if err != nil {
+		return CardData{}, err
+	}
+	classId, err := googleClassId()
+	if err != nil {
+		return CardData{}, err
+	}
+	objectId, err := googleObjectId(classId, m)
+	if err != nil {
+		return CardData{}, err
+	}
+	schema, err := csvSchema()
+	if err != nil {
+		return CardData{}, err
+	}
+	layout, err := cardFieldLayout(schema)
+	if err != nil {
+		return CardData{}, err
+	}
+	expiration, err := passExpiration(m)
+	if err != nil {
+		return CardData{}, err
+	}
+	heroImage, err := cardImage(m)
+	if err != nil {
+		return CardData{}, err
+	}
+	color, err := cardColor(m)
+	if err != nil {
+		return CardData{}, err
+	}
+	barcodeValue, err := cardBarcodeValue(m)
+	if err != nil {
+		return CardData{}, err
+	}
+	shown, err := cardDisplayMember(m)
+	if err != nil {
+		return CardData{}, err
+	}
+	modules := layout.textModules(shown, labels, now)
+	banner, inGrace, err := graceBanner(m, labels, now)
+	if err != nil {
+		return CardData{}, err
+	}
+	if inGrace {
+		modules = append([]TextModule{banner}, modules...)
+	}
+	notes, err := loadCardNotes()
+	if err != nil {
+		return CardData{}, err
+	}
+	noteModules, links, err := notes.backContent(m)
+	if err != nil {
+		return CardData{}, err
+	}
+	modules = append(modules, noteModules...)
+	// Notes come after the banner and the layout fields, so they are the
+	// first modules dropped past what Wallet shows.
+	if limit := regionMaxFields("text"); len(modules) > limit {
+		log.Printf("Warning: card of member %s has %d text modules, Wallet shows %d, dropping the last ones", m.ID, len(modules), limit)
+		modules = modules[:limit]
+	}
+	compliance, err := complianceLinks(labels)
+	if err != nil {
+		return CardData{}, err
+	}
+	links = append(links, compliance...)
+	// Expired cards are greyed out and labelled as such, for staff checking
+	// cards by eye. Members in their grace period still hold an active card,
+	// with the renewal banner.
+	state, subheader := "ACTIVE", labels.Member
+	if !m.ExpirationDate.IsZero() && daysBetween(now, m.ExpirationDate) < 0 && !inGrace {
+		state, subheader = "EXPIRED", labels.Expired
+		if color, err = cardExpiredColor(); err != nil {
+			return CardData{}, err
+		}
+	}
+	return CardData{
+		ObjectID:       objectId,
+		ClassID:        classId,
+		State:          state,
+		Subheader:      subheader,
+		Header:         layout.header(shown, labels, now),
+		Labels:         labels,
+		TextModules:    modules,
+		BarcodeType:    barcode.Google,
+		BarcodeValue:   barcodeValue,
+		PassExpiration: expiration,
+		HeroImage:      heroImage,
+		Color:          color,
+		Links:          links,
+	}, nil
+}
+
+// cardRequiredFields reads CARD_REQUIRED_FIELDS, the member fields a card
+// can't be issued without (default "name", the display name).
+func cardRequiredFields(schema *Schema) ([]string, error) {
+	fields := splitList(os.Getenv("CARD_REQUIRED_FIELDS"), ",")
+	if len(fields) == 0 {
+		return []string{"name"}, nil
+	}
+	known := filterableFields(schema)
+	known["name"] = true
+	for _, field := range fields {
+		if !known[field] {
+			return nil, fmt.Errorf("CARD_REQUIRED_FIELDS has unknown field %q", field)
+		}
+	}
+	return fields, nil
+}
+
+// cardIncompleteFallback reads CARD_INCOMPLETE_POLICY: "refuse" (the
+// default) answers 422 for members missing required fields, "fallback"
+// issues them a minimal card asking them to contact the office.
+func cardIncompleteFallback() (bool, error) {
+	switch policy := os.Getenv("CARD_INCOMPLETE_POLICY"); policy {
+	case "", "refuse":
+		return false, nil
+	case "fallback":
+		return true, nil
+	default:
+		return false, fmt.Errorf("CARD_INCOMPLETE_POLICY must be refuse or fallback, got %q", policy)
+	}
+}
+
+// cardExpiredIssuance reads CARD_EXPIRED_POLICY: "refuse" (the default)
+// answers 403 for members whose membership has expired, "issue" gives them
+// a card in the expired state, greyed out and labelled, so they can see it
+// lapsed and need renewing. Members inactive under ACTIVE_RULE before their
+// expiration date are refused either way.
+func cardExpiredIssuance() (bool, error) {
+	switch policy := os.Getenv("CARD_EXPIRED_POLICY"); policy {
+	case "", "refuse":
+		return false, nil
+	case "issue":
+		return true, nil
+	default:
+		return false, fmt.Errorf("CARD_EXPIRED_POLICY must be refuse or issue, got %q", policy)
 	}
-	templateStr := string(templateBytes)
+}
 
-	data := struct {
-		FirstName      string
-		LastName       string
-		ExpirationDate string
-	}{
-		FirstName:      firstName,
-		LastName:       lastName,
-		ExpirationDate: expirationDate,
+// fallback strips a card down to the member name, when there is one, and the
+// support message, CARD_SUPPORT_MESSAGE overriding the label.
+func (card CardData) fallback() CardData {
+	if card.Header == "" {
+		card.Header = card.Labels.Member
 	}
-	tmpl, err := template.New("jsonTemplate").Parse(templateStr)
+	message := os.Getenv("CARD_SUPPORT_MESSAGE")
+	if message == "" {
+		message = card.Labels.SupportText
+	}
+	card.TextModules = []TextModule{{ID: "support", Header: card.Labels.Support, Body: message}}
+	return card
+}
+
+// missingCardFields lists the required card fields a member has no value for.
+func missingCardFields(m Member, required []string) []string {
+	var missing []string
+	for _, field := range required {
+		value := m.displayName()
+		if field != "name" {
+			value = strings.Join(memberFieldValues(m, field), "")
+		}
+		if strings.TrimSpace(value) == "" {
+			missing = append(missing, field)
+		}
+	}
+	return missing
+}
+
+// cardMember returns the member a card is requested for, looked up in the
+// roster by the id query parameter. Cards are only issued to roster
+// members, so the issuance guards apply to what the roster says about them.
+// On error, status is the HTTP status to answer with.
+func cardMember(r *http.Request) (member Member, status int, err error) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		return Member{}, http.StatusBadRequest, fmt.Errorf("id query parameter is required")
+	}
+	members, _, err := loadRoster()
+	if err != nil {
+		return Member{}, rosterErrorStatus(err), fmt.Errorf("Error fetching member data: %v", err)
+	}
+	member, ok := findMember(members, id)
+	if !ok {
+		return Member{}, http.StatusNotFound, fmt.Errorf("no member with id %q", id)
+	}
+	return member, http.StatusOK, nil
+}
+
+// jsonString quotes a value for the JSON templates; html/template escaping
+// would mangle member data in the card payload.
+func jsonString(value any) (string, error) {
+	encoded, err := json.Marshal(value)
+	return string(encoded), err
+}
+
+func renderJsonTemplate(templateFile string, data any) (string, error) {
+	tmpl, err := jsonTemplate(templateFile)
 	if err != nil {
-		return "", fmt.Errorf("error parsing JSON template: %v", err)
+		return "", err
 	}
 
-	var renderedTemplate strings.Builder
-	err = tmpl.Execute(&renderedTemplate, data)
+	renderedTemplate, err := executeLimited(tmpl, data)
 	if err != nil {
 		return "", fmt.Errorf("error rendering JSON template: %v", err)
 	}
 
-	return renderedTemplate.String(), nil
+	return string(renderedTemplate), nil
 }
 
 func generateGoogleCardHandler(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query()
-	firstName := query.Get("firstName")
-	lastName := query.Get("lastName")
-	expirationDate := query.Get("ExpirationDate")
+	member, status, err := cardMember(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	schema, err := csvSchema()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rule, err := loadActiveRule(schema)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	now := time.Now()
+	_, inGrace, err := graceEnd(member, now)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	issueExpired, err := cardExpiredIssuance()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	expired := !member.ExpirationDate.IsZero() && daysBetween(now, member.ExpirationDate) < 0
+	if !rule.active(member, now) && !inGrace && !(expired && issueExpired) {
+		http.Error(w, "Membership is not active, no card can be generated", http.StatusForbidden)
+		return
+	}
 
-	jsonPayload, err := renderJsonTemplate(firstName, lastName, expirationDate)
+	required, err := cardRequiredFields(schema)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fallback, err := cardIncompleteFallback()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	missing := missingCardFields(member, required)
+	if len(missing) > 0 && !fallback {
+		http.Error(w, "Member is missing "+strings.Join(missing, ", ")+", no card can be generated", http.StatusUnprocessableEntity)
+		return
+	}
+
+	card, err := newCardData(member, now)
+	if err != nil {
+		http.Error(w, "Error generating JSON payload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(missing) > 0 {
+		log.Printf("Member %s is missing %s, issuing the fallback card", member.ID, strings.Join(missing, ", "))
+		card = card.fallback()
+	}
+
+	jsonPayload, err := renderJsonTemplate("./google_card.json", card)
 	if err != nil {
 		http.Error(w, "Error generating JSON payload: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	if wantsJsonReceipt(r) {
+		receipt, err := newCardReceipt(member, "google", jsonPayload, card, now)
+		if err != nil {
+			http.Error(w, "Error generating card receipt: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(receipt); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
 	fmt.Fprintln(w, jsonPayload)
 }
 
+// cardIssueStart is the optional CARD_ISSUE_START date (YYYY-MM-DD) before
+// which no card is issued, while the roster and UI keep working.
+func cardIssueStart() (time.Time, error) {
+	value := os.Getenv("CARD_ISSUE_START")
+	if value == "" {
+		return time.Time{}, nil
+	}
+	start, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("CARD_ISSUE_START must be a YYYY-MM-DD date, got %q", value)
+	}
+	return start, nil
+}
+
+func requireCardIssuance(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start, err := cardIssueStart()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if time.Now().Before(start) {
+			http.Error(w, "Cards are not yet available, they can be generated from "+start.Format("02/01/2006"), http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	}
+}
+
 func generateGoogleCard(jsonPayload string) (string, error) {
 	return "", nil
 }
@@ -183,12 +1035,37 @@ func generateAppleCardHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
+	validate := flag.Bool("validate", false, "validate the roster (a CSV file argument, or CSV_URL) and exit")
+	format := flag.String("format", "text", "validation output format: text or json")
+	flag.Parse()
+	if *validate {
+		os.Exit(runValidate(flag.Arg(0), *format, os.Stdout))
+	}
+
 	http.HandleFunc("/", viewHomeHandler)
-	http.HandleFunc("/card/generate_google", generateGoogleCardHandler)
-	http.HandleFunc("/card/generate_apple", generateAppleCardHandler)
+	http.HandleFunc("/card/generate_google", requireGoogleCards(requireCardIssuance(generateGoogleCardHandler)))
+	http.HandleFunc("/card/generate_apple", requireCardIssuance(generateAppleCardHandler))
+	http.HandleFunc("/api/members", withCors(membersApiHandler))
+	http.HandleFunc("/api/members.xlsx", withCors(membersXlsxHandler))
+	http.HandleFunc("/member/{id}/row", viewMemberRowHandler)
+	http.HandleFunc("/admin/google-class.json", requireGoogleCards(googleClassHandler))
+	http.HandleFunc("/schema/member.json", withCors(memberSchemaHandler))
+	http.HandleFunc("/photo/{id}", photoHandler)
+	http.HandleFunc("/healthz", healthzHandler)
+	http.HandleFunc("/verify", verifyHandler)
+	http.HandleFunc("/status", statusHandler)
+	if reasons := googleCardsUnavailable(); len(reasons) > 0 {
+		if !degradedModeAllowed() {
+			log.Fatalf("Google cards are not configured: %s", strings.Join(reasons, "; "))
+		}
+		log.Printf("Starting in degraded mode, Google cards are disabled: %s", strings.Join(reasons, "; "))
+	}
+	// Warm-up runs before the server listens, so no request pays for it.
+	if prewarmEnabled() {
+		warmUp()
+	} else {
+		ready.Store(true)
+	}
 	fmt.Println("Listening http://localhost:8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
-			if err != nil {
-				panic(fmt.Errorf("Error parsing join date for row %d: %v", i, err))
-			}
@@ -0,0 +1,698 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"text/template"
+	"time"
+)
+
+// serveRosterCsv points CSV_URL at a server answering with the roster and
+// forgets the last good roster of earlier tests.
+func serveRosterCsv(t *testing.T, roster string) *httptest.Server {
+	t.Helper()
+	return serveRosterSource(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, roster)
+	}))
+}
+
+// serveFlakyRoster is serveRosterCsv with a source answering 404 while up
+// is false, like a sheet being re-shared.
+func serveFlakyRoster(t *testing.T, roster string, up *atomic.Bool) {
+	t.Helper()
+	serveRosterSource(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !up.Load() {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, roster)
+	}))
+}
+
+func serveRosterSource(t *testing.T, handler http.Handler) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	t.Setenv("ROSTER_SOURCE", "")
+	t.Setenv("CSV_URL", server.URL)
+	lastGoodRoster.Lock()
+	lastGoodRoster.members, lastGoodRoster.fetchedAt = nil, time.Time{}
+	lastGoodRoster.Unlock()
+	return server
+}
+
+// useSchema points CSV_SCHEMA at a schema file holding content.
+func useSchema(t *testing.T, content string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CSV_SCHEMA", path)
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		value   string
+		pivot   string
+		want    string
+		wantErr bool
+	}{
+		{value: "01/03/2026", want: "2026-03-01"},
+		{value: "2026-03-01", want: "2026-03-01"},
+		{value: " 1/3/2026 ", want: "2026-03-01"},
+		{value: "13/12/2024", want: "2024-12-13"},
+		{value: "12/31/2024", want: "2024-12-31"},
+		{value: "01/03/29", want: "2029-03-01"},
+		{value: "01/03/30", want: "1930-03-01"},
+		{value: "01/03/75", want: "1975-03-01"},
+		{value: "01/03/29", pivot: "0", want: "1929-03-01"},
+		{value: "01/03/99", pivot: "100", want: "2099-03-01"},
+		{value: "01/03/70", pivot: "80", want: "2070-03-01"},
+		{value: "29/02/00", want: "2000-02-29"},
+		{value: "29/02/04", pivot: "0", want: "1904-02-29"},
+		{value: "29/02/00", pivot: "0", wantErr: true},
+		{value: "31/02/2024", wantErr: true},
+		{value: "someday", wantErr: true},
+		{value: "01/03/26", pivot: "101", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value+" pivot "+tt.pivot, func(t *testing.T) {
+			t.Setenv("TWO_DIGIT_YEAR_PIVOT", tt.pivot)
+			got, err := parseDate(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseDate(%q) = %s, want an error", tt.value, got.Format(time.DateOnly))
+				}
+				return
+			}
+			if err != nil || got.Format(time.DateOnly) != tt.want {
+				t.Errorf("parseDate(%q) = %s, %v, want %s", tt.value, got.Format(time.DateOnly), err, tt.want)
+			}
+		})
+	}
+}
+
+func TestOutboundClientTimeouts(t *testing.T) {
+	destinations := []struct {
+		variable string
+		fallback time.Duration
+	}{
+		{"CSV_FETCH_TIMEOUT", 60 * time.Second},
+		{"JSON_API_TIMEOUT", 60 * time.Second},
+		{"BILLING_API_TIMEOUT", 5 * time.Second},
+		{"PHOTO_FETCH_TIMEOUT", 10 * time.Second},
+	}
+	for _, destination := range destinations {
+		t.Run(destination.variable, func(t *testing.T) {
+			for _, other := range destinations {
+				t.Setenv(other.variable, "")
+			}
+			t.Setenv(destination.variable, "250ms")
+			for _, other := range destinations {
+				client, err := outboundClient(other.variable, other.fallback)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want := other.fallback
+				if other.variable == destination.variable {
+					want = 250 * time.Millisecond
+				}
+				if client.Timeout != want {
+					t.Errorf("%s timeout = %s, want %s", other.variable, client.Timeout, want)
+				}
+			}
+			for _, invalid := range []string{"0s", "-1s", "soon"} {
+				t.Setenv(destination.variable, invalid)
+				if _, err := outboundClient(destination.variable, destination.fallback); err == nil {
+					t.Errorf("%s=%s was accepted", destination.variable, invalid)
+				}
+			}
+		})
+	}
+}
+
+// A slow upstream only fails the destination whose timeout it exceeds.
+func TestOutboundTimeoutsAreIndependent(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprint(w, `{"paid_through":"2030-01-01"}`)
+	}))
+	defer slow.Close()
+	t.Setenv("CSV_FETCH_TIMEOUT", "5s")
+	t.Setenv("BILLING_API_TIMEOUT", "50ms")
+	t.Setenv("BILLING_API_URL", slow.URL+"/{id}")
+
+	body, err := fetchCSV(slow.URL)
+	if err != nil {
+		t.Errorf("fetchCSV failed within CSV_FETCH_TIMEOUT: %v", err)
+	} else {
+		body.Close()
+	}
+	api, _, err := loadBillingApi()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := api.fetch(api.memberUrl(Member{ID: "1"})); err == nil {
+		t.Error("billing lookup outlived BILLING_API_TIMEOUT")
+	}
+}
+
+const cardRoster = `id,first_name,last_name,email,status,join_date
+a1,Jane,Doe,jane@example.com,paid,2026-03-01
+a2,John,Roe,john@example.com,due,2020-03-01
+`
+
+func requestGoogleCard(t *testing.T, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	generateGoogleCardHandler(rec, httptest.NewRequest(http.MethodGet, "/card/generate_google?"+query, nil))
+	return rec
+}
+
+// Cards only go to roster members, so the active rule can't be sidestepped
+// by describing a member on the query string.
+func TestCardsAreIssuedToRosterMembers(t *testing.T) {
+	serveRosterCsv(t, cardRoster)
+	useSchema(t, apiSchema)
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+
+	tests := []struct {
+		query      string
+		wantStatus int
+	}{
+		{"id=a1", http.StatusOK},
+		{"id=a2", http.StatusForbidden},
+		{"id=zz", http.StatusNotFound},
+		{"firstName=Eve&lastName=Doe", http.StatusBadRequest},
+		{"firstName=Eve&lastName=Doe&ExpirationDate=2099-01-01", http.StatusBadRequest},
+		{"", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			if rec := requestGoogleCard(t, tt.query); rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestCsvChecksum(t *testing.T) {
+	sum := sha256.Sum256([]byte(apiRoster))
+	tests := []struct {
+		name    string
+		sidecar string
+		wantErr string
+	}{
+		{"matching", hex.EncodeToString(sum[:]) + "  roster.csv\n", ""},
+		{"matching in upper case", strings.ToUpper(hex.EncodeToString(sum[:])), ""},
+		{"mismatching", strings.Repeat("0", 64) + "  roster.csv\n", "checksum mismatch"},
+		{"empty", "", "is empty"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if strings.HasSuffix(r.URL.Path, ".sha256") {
+					fmt.Fprint(w, tt.sidecar)
+					return
+				}
+				fmt.Fprint(w, apiRoster)
+			}))
+			defer server.Close()
+			t.Setenv("CSV_SCHEMA", "")
+			t.Setenv("CSV_CHECKSUM_URL", "{url}.sha256")
+
+			members, err := readCSVFromUrl(server.URL + "/roster.csv")
+			if tt.wantErr == "" {
+				if err != nil || len(members) != 2 {
+					t.Errorf("readCSVFromUrl() = %d members, %v, want the 2 members", len(members), err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readCSVFromUrl() error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// A download that doesn't match its checksum keeps the last good roster.
+func TestCsvChecksumMismatchKeepsLastGoodRoster(t *testing.T) {
+	serveRosterCsv(t, apiRoster)
+	t.Setenv("CSV_SCHEMA", "")
+	if _, _, err := loadRoster(); err != nil {
+		t.Fatal(err)
+	}
+	sidecar := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, strings.Repeat("0", 64))
+	}))
+	defer sidecar.Close()
+	t.Setenv("CSV_CHECKSUM_URL", sidecar.URL+"/roster.sha256")
+	members, stale, err := loadRoster()
+	if err != nil || !stale || len(members) != 2 {
+		t.Errorf("loadRoster() = %d members, stale %v, %v, want the last good 2 members", len(members), stale, err)
+	}
+}
+
+func TestHomeServesLastGoodRosterOnFetchFailure(t *testing.T) {
+	up := &atomic.Bool{}
+	serveFlakyRoster(t, apiRoster, up)
+	t.Setenv("CSV_SCHEMA", "")
+	home := func() *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		viewHomeHandler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+		return rec
+	}
+
+	if rec := home(); rec.Code != http.StatusInternalServerError {
+		t.Errorf("without a good roster yet: status %d, want 500", rec.Code)
+	}
+
+	up.Store(true)
+	rec := home()
+	if rec.Code != http.StatusOK || rec.Header().Get("Warning") != "" {
+		t.Fatalf("fresh roster: status %d, Warning %q", rec.Code, rec.Header().Get("Warning"))
+	}
+
+	up.Store(false)
+	rec = home()
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Jane") {
+		t.Errorf("source down: status %d, want 200 with the last good roster: %s", rec.Code, rec.Body)
+	}
+	if !strings.Contains(rec.Header().Get("Warning"), "serving last good data") {
+		t.Errorf("source down: Warning %q, want the stale-data warning", rec.Header().Get("Warning"))
+	}
+}
+
+func TestCardIssueStart(t *testing.T) {
+	serveRosterCsv(t, cardRoster)
+	useSchema(t, apiSchema)
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+	today := time.Now()
+
+	tests := []struct {
+		name       string
+		start      string
+		wantStatus int
+	}{
+		{"no embargo", "", http.StatusOK},
+		{"before launch", today.AddDate(0, 0, 1).Format("2006-01-02"), http.StatusForbidden},
+		{"launch day", today.Format("2006-01-02"), http.StatusOK},
+		{"after launch", today.AddDate(0, 0, -1).Format("2006-01-02"), http.StatusOK},
+		{"invalid date", "01/03/2026", http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("CARD_ISSUE_START", tt.start)
+			rec := httptest.NewRecorder()
+			requireCardIssuance(generateGoogleCardHandler)(rec, httptest.NewRequest(http.MethodGet, "/card/generate_google?id=a1", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus == http.StatusForbidden && !strings.Contains(rec.Body.String(), "not yet available") {
+				t.Errorf("embargo answer %q, want it to say cards are not yet available", rec.Body)
+			}
+
+			// The roster and the UI keep working during the embargo.
+			home := httptest.NewRecorder()
+			viewHomeHandler(home, httptest.NewRequest(http.MethodGet, "/", nil))
+			if home.Code != http.StatusOK {
+				t.Errorf("home page: status %d", home.Code)
+			}
+		})
+	}
+}
+
+func TestExecuteLimited(t *testing.T) {
+	tmpl := template.Must(template.New("rows").Parse(`{{range .}}{{.}}{{end}}`))
+	rows := make([]string, 1000)
+	for i := range rows {
+		rows[i] = "0123456789"
+	}
+	tests := []struct {
+		limit   string
+		rows    int
+		wantErr string
+	}{
+		{"", 1000, ""},
+		{"100", 10, ""},
+		{"100", 11, "template output exceeds 100 bytes"},
+		{"1000", 1000, "template output exceeds 1000 bytes"},
+		{"lots", 1, "TEMPLATE_OUTPUT_LIMIT must be a positive number"},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.limit, tt.rows), func(t *testing.T) {
+			t.Setenv("TEMPLATE_OUTPUT_LIMIT", tt.limit)
+			output, err := executeLimited(tmpl, rows[:tt.rows])
+			if tt.wantErr == "" {
+				if err != nil || len(output) != 10*tt.rows {
+					t.Errorf("executeLimited() = %d bytes, %v, want %d bytes", len(output), err, 10*tt.rows)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) || output != nil {
+				t.Errorf("executeLimited() = %d bytes, %v, want no output and %q", len(output), err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// An oversized page is answered with an error, not a truncated page.
+func TestOversizedPageFailsCleanly(t *testing.T) {
+	serveRosterCsv(t, apiRoster)
+	useSchema(t, apiSchema)
+	t.Setenv("TEMPLATE_OUTPUT_LIMIT", "200")
+	rec := httptest.NewRecorder()
+	viewHomeHandler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", rec.Code)
+	}
+	if body := rec.Body.String(); strings.Contains(body, "<") || !strings.Contains(body, "exceeds 200 bytes") {
+		t.Errorf("body %q, want only the error", body)
+	}
+}
+
+func TestCardBarcodeFormats(t *testing.T) {
+	serveRosterCsv(t, cardRoster)
+	useSchema(t, apiSchema)
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+
+	tests := []struct {
+		shared, google, apple string
+		wantGoogle, wantApple string
+		wantErr               bool
+	}{
+		{"", "", "", "TEXT_ONLY", "", false},
+		{"text", "", "", "TEXT_ONLY", "", false},
+		{"qr", "", "", "QR_CODE", "PKBarcodeFormatQR", false},
+		{"PDF417", "", "", "PDF_417", "PKBarcodeFormatPDF417", false},
+		{"aztec", "", "", "AZTEC", "PKBarcodeFormatAztec", false},
+		{"code128", "", "", "CODE_128", "PKBarcodeFormatCode128", false},
+		{"qr", "", "code128", "QR_CODE", "PKBarcodeFormatCode128", false},
+		{"", "qr", "code128", "QR_CODE", "PKBarcodeFormatCode128", false},
+		{"pdf417", "text", "", "TEXT_ONLY", "PKBarcodeFormatPDF417", false},
+		{"", "", "text", "", "", true},
+		{"ean13", "", "", "", "", true},
+		{"qr", "", "datamatrix", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shared+"/"+tt.google+"/"+tt.apple, func(t *testing.T) {
+			t.Setenv("CARD_BARCODE_FORMAT", tt.shared)
+			t.Setenv("GOOGLE_BARCODE_FORMAT", tt.google)
+			t.Setenv("APPLE_BARCODE_FORMAT", tt.apple)
+			format, err := cardBarcodeFormat()
+			rec := requestGoogleCard(t, "id=a1")
+			if tt.wantErr {
+				if err == nil || rec.Code == http.StatusOK {
+					t.Errorf("cardBarcodeFormat() = %+v, card status %d, want an error", format, rec.Code)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Apple passes aren't rendered yet, their symbology is the one
+			// pass.json will carry.
+			if format.Apple != tt.wantApple {
+				t.Errorf("Apple format %q, want %q", format.Apple, tt.wantApple)
+			}
+			var card struct {
+				Barcode struct {
+					Type string `json:"type"`
+				} `json:"barcode"`
+			}
+			if err := json.NewDecoder(rec.Body).Decode(&card); err != nil {
+				t.Fatalf("status %d: %v", rec.Code, err)
+			}
+			if card.Barcode.Type != tt.wantGoogle {
+				t.Errorf("Google barcode type %q, want %q", card.Barcode.Type, tt.wantGoogle)
+			}
+		})
+	}
+}
+
+func TestViewMemberRow(t *testing.T) {
+	serveRosterCsv(t, apiRoster)
+	useSchema(t, apiSchema)
+	row := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/member/"+id+"/row", nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		viewMemberRowHandler(rec, req)
+		return rec
+	}
+
+	rec := row("a1")
+	fragment := strings.TrimSpace(rec.Body.String())
+	if rec.Code != http.StatusOK || !strings.HasPrefix(fragment, `<tr id="member-a1">`) || !strings.HasSuffix(fragment, "</tr>") {
+		t.Fatalf("status %d, want the row of a1 alone: %s", rec.Code, fragment)
+	}
+	for _, chrome := range []string{"<html", "<head", "<table", "Memberships", "John"} {
+		if strings.Contains(fragment, chrome) {
+			t.Errorf("row fragment contains %q: %s", chrome, fragment)
+		}
+	}
+	home := httptest.NewRecorder()
+	viewHomeHandler(home, httptest.NewRequest(http.MethodGet, "/", nil))
+	if !strings.Contains(home.Body.String(), fragment) {
+		t.Error("the row fragment differs from the row on the home page")
+	}
+
+	if rec := row("zz"); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown member: status %d, want 404", rec.Code)
+	}
+}
+
+// The pass outlives the membership by PASS_EXPIRY_BUFFER, showing the
+// expired state meanwhile.
+func TestPassExpiryBuffer(t *testing.T) {
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+	t.Setenv("PASS_EXPIRY_BUFFER", "168h")
+	now := date("2026-10-14")
+	tests := []struct {
+		name           string
+		expiration     time.Time
+		wantPassExpiry string
+		wantState      string
+	}{
+		{"current", date("2026-12-31"), "2027-01-07T00:00:00Z", "ACTIVE"},
+		{"lapsed yesterday", date("2026-10-13"), "2026-10-20T00:00:00Z", "EXPIRED"},
+		{"last day of the buffer", date("2026-10-07"), "2026-10-14T00:00:00Z", "EXPIRED"},
+		{"past the buffer", date("2026-10-06"), "2026-10-13T00:00:00Z", "EXPIRED"},
+		{"lifetime", time.Time{}, "", "ACTIVE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card, err := newCardData(Member{ID: "a1", FirstName: "Jane", ExpirationDate: tt.expiration}, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if card.PassExpiration != tt.wantPassExpiry || card.State != tt.wantState {
+				t.Errorf("pass expiration %q, state %s, want %q, %s", card.PassExpiration, card.State, tt.wantPassExpiry, tt.wantState)
+			}
+		})
+	}
+
+	t.Setenv("PASS_EXPIRY_BUFFER", "")
+	card, err := newCardData(Member{ID: "a1", FirstName: "Jane", ExpirationDate: date("2026-12-31")}, now)
+	if err != nil || card.PassExpiration != "2026-12-31T00:00:00Z" {
+		t.Errorf("without a buffer: pass expiration %q, %v, want the membership expiration", card.PassExpiration, err)
+	}
+}
+
+func TestMaxStale(t *testing.T) {
+	up := &atomic.Bool{}
+	serveFlakyRoster(t, apiRoster, up)
+	t.Setenv("CSV_SCHEMA", "")
+	tests := []struct {
+		name       string
+		maxStale   string
+		age        time.Duration
+		wantStatus int
+	}{
+		{"no limit", "", 90 * 24 * time.Hour, http.StatusOK},
+		{"within the limit", "1h", 30 * time.Minute, http.StatusOK},
+		{"just within the limit", "1h", time.Hour - time.Second, http.StatusOK},
+		{"just past the limit", "1h", time.Hour + time.Second, http.StatusServiceUnavailable},
+		{"well past the limit", "1h", 48 * time.Hour, http.StatusServiceUnavailable},
+		{"invalid limit", "an hour", time.Minute, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("MAX_STALE", "")
+			up.Store(true)
+			if _, _, err := loadRoster(); err != nil {
+				t.Fatal(err)
+			}
+			lastGoodRoster.Lock()
+			lastGoodRoster.fetchedAt = time.Now().Add(-tt.age)
+			lastGoodRoster.Unlock()
+
+			up.Store(false)
+			t.Setenv("MAX_STALE", tt.maxStale)
+			rec := httptest.NewRecorder()
+			viewHomeHandler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus == http.StatusServiceUnavailable && !strings.Contains(rec.Body.String(), "older than MAX_STALE") {
+				t.Errorf("body %q, want the stale roster reported", rec.Body)
+			}
+		})
+	}
+}
+
+// incompleteRoster has a member with only an email and one without a
+// status.
+const incompleteRoster = cardRoster + `a3,,,ann@example.com,paid,2026-03-01
+a4,Ann,Poe,,,2026-03-01
+`
+
+func TestCardRequiredFields(t *testing.T) {
+	serveRosterCsv(t, incompleteRoster)
+	useSchema(t, apiSchema)
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+	tests := []struct {
+		required   string
+		id         string
+		wantStatus int
+		wantBody   string
+	}{
+		{"", "a1", http.StatusOK, ""},
+		{"", "a3", http.StatusUnprocessableEntity, "Member is missing name, no card can be generated"},
+		{"", "a4", http.StatusOK, ""},
+		{"name,email,status", "a1", http.StatusOK, ""},
+		{"name,email,status", "a4", http.StatusUnprocessableEntity, "Member is missing email, status, no card can be generated"},
+		{"tier", "a1", http.StatusInternalServerError, `CARD_REQUIRED_FIELDS has unknown field "tier"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.required+" "+tt.id, func(t *testing.T) {
+			t.Setenv("CARD_REQUIRED_FIELDS", tt.required)
+			rec := requestGoogleCard(t, "id="+tt.id)
+			if rec.Code != tt.wantStatus || !strings.Contains(rec.Body.String(), tt.wantBody) {
+				t.Errorf("status %d, body %q, want %d, %q", rec.Code, rec.Body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestCardIncompletePolicy(t *testing.T) {
+	serveRosterCsv(t, incompleteRoster)
+	useSchema(t, apiSchema)
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+	t.Setenv("CARD_REQUIRED_FIELDS", "name,status")
+	var card struct {
+		Header struct {
+			DefaultValue struct {
+				Value string `json:"value"`
+			} `json:"defaultValue"`
+		} `json:"header"`
+		TextModules []TextModule `json:"textModulesData"`
+	}
+	tests := []struct {
+		policy      string
+		message     string
+		id          string
+		wantStatus  int
+		wantHeader  string
+		wantModules []TextModule
+	}{
+		{"", "", "a4", http.StatusUnprocessableEntity, "", nil},
+		{"refuse", "", "a3", http.StatusUnprocessableEntity, "", nil},
+		{"fallback", "", "a4", http.StatusOK, "Ann Poe", []TextModule{{ID: "support", Header: "Informations", Body: "Votre fiche adhérent est incomplète, contactez le bureau"}}},
+		{"fallback", "", "a3", http.StatusOK, "Membre", []TextModule{{ID: "support", Header: "Informations", Body: "Votre fiche adhérent est incomplète, contactez le bureau"}}},
+		{"fallback", "Call 02 40 00 00 00", "a4", http.StatusOK, "Ann Poe", []TextModule{{ID: "support", Header: "Informations", Body: "Call 02 40 00 00 00"}}},
+		{"fallback", "", "a1", http.StatusOK, "Jane Doe", nil},
+		{"lenient", "", "a4", http.StatusInternalServerError, "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy+" "+tt.id, func(t *testing.T) {
+			t.Setenv("CARD_INCOMPLETE_POLICY", tt.policy)
+			t.Setenv("CARD_SUPPORT_MESSAGE", tt.message)
+			rec := requestGoogleCard(t, "id="+tt.id)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if rec.Code != http.StatusOK {
+				return
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &card); err != nil {
+				t.Fatal(err)
+			}
+			if card.Header.DefaultValue.Value != tt.wantHeader {
+				t.Errorf("header %q, want %q", card.Header.DefaultValue.Value, tt.wantHeader)
+			}
+			// Complete members keep their full card.
+			if tt.wantModules == nil {
+				if len(card.TextModules) == 0 || card.TextModules[0].ID == "support" {
+					t.Errorf("text modules %+v, want the full card", card.TextModules)
+				}
+				return
+			}
+			if !reflect.DeepEqual(card.TextModules, tt.wantModules) {
+				t.Errorf("text modules %+v, want %+v", card.TextModules, tt.wantModules)
+			}
+		})
+	}
+}
+
+// homeSections reads the home page back as its section headers and member
+// rows, in page order.
+var homeSections = regexp.MustCompile(`<th colspan="6"[^>]*>([^<]*)</th>|<tr id="member-([^"]+)">`)
+
+func TestHomeGroupBy(t *testing.T) {
+	serveRosterCsv(t, `id,first_name,last_name,email,status,chapter,join_date
+a1,Jane,Doe,jane@example.com,paid,Nantes,2026-03-01
+a2,John,Roe,john@example.com,due,Paris,2020-03-01
+a3,Ann,Poe,ann@example.com,paid,Nantes,2026-03-01
+a4,Noor,Lee,noor@example.com,paid,,2026-03-01
+`)
+	useSchema(t, `{"columns": [
+		{"name": "id", "header": "id", "type": "string"},
+		{"name": "first_name", "header": "first_name", "type": "string"},
+		{"name": "last_name", "header": "last_name", "type": "string"},
+		{"name": "email", "header": "email", "type": "email"},
+		{"name": "status", "header": "status", "type": "string"},
+		{"name": "chapter", "header": "chapter", "type": "string"},
+		{"name": "join_date", "header": "join_date", "type": "date"}
+	]}`)
+	tests := []struct {
+		groupBy    string
+		wantStatus int
+		want       []string
+	}{
+		{"", http.StatusOK, []string{"a1", "a2", "a3", "a4"}},
+		{"chapter", http.StatusOK, []string{"Nantes (2)", "a1", "a3", "Paris (1)", "a2", "No chapter (1)", "a4"}},
+		{"status", http.StatusOK, []string{"due (1)", "a2", "paid (3)", "a1", "a3", "a4"}},
+		{"membership", http.StatusOK, []string{"active (3)", "a1", "a3", "a4", "inactive (1)", "a2"}},
+		{"tier", http.StatusBadRequest, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.groupBy, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			viewHomeHandler(rec, httptest.NewRequest(http.MethodGet, "/?group_by="+tt.groupBy, nil))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			var got []string
+			for _, match := range homeSections.FindAllStringSubmatch(rec.Body.String(), -1) {
+				got = append(got, match[1]+match[2])
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("page sections and rows %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"os"
+	"strings"
+)
+
+var (
+	defaultNameTitles   = "Dr,Pr,Prof,M,Mme,Mlle,Me,Mr,Mrs,Ms,Mx"
+	defaultNameSuffixes = "Jr,Sr,II,III,IV,PhD,MD,Esq"
+)
+
+// nameParts recognises honorifics at the start of a member's name and
+// suffixes at its end, so "Dr. Jane Smith, PhD" keeps "Jane Smith" as the
+// name proper.
+type nameParts struct {
+	titles   map[string]bool
+	suffixes map[string]bool
+}
+
+func nameTokens(list string) map[string]bool {
+	tokens := map[string]bool{}
+	for _, token := range splitList(list, ",") {
+		tokens[normalizeNameToken(token)] = true
+	}
+	return tokens
+}
+
+func normalizeNameToken(token string) string {
+	return strings.ToLower(strings.TrimRight(strings.TrimSpace(token), ".,"))
+}
+
+// loadNameParts returns nil unless PARSE_NAME_TITLES is "true". NAME_TITLES
+// and NAME_SUFFIXES replace the recognised tokens (comma separated, matched
+// case-insensitively and with or without a trailing dot).
+func loadNameParts() *nameParts {
+	if os.Getenv("PARSE_NAME_TITLES") != "true" {
+		return nil
+	}
+	titles := os.Getenv("NAME_TITLES")
+	if titles == "" {
+		titles = defaultNameTitles
+	}
+	suffixes := os.Getenv("NAME_SUFFIXES")
+	if suffixes == "" {
+		suffixes = defaultNameSuffixes
+	}
+	return &nameParts{titles: nameTokens(titles), suffixes: nameTokens(suffixes)}
+}
+
+// apply moves leading titles of the first name and trailing suffixes of the
+// last name into Member.Title and Member.Suffix. When the roster keeps the
+// whole name in one of the two columns, that column is used for both.
+func (p *nameParts) apply(m *Member) {
+	if p == nil {
+		return
+	}
+	first, last := &m.FirstName, &m.LastName
+	if *first == "" {
+		first = last
+	}
+	if *last == "" {
+		last = first
+	}
+
+	words := strings.Fields(*first)
+	var titles []string
+	for len(words) > 1 && p.titles[normalizeNameToken(words[0])] {
+		titles = append(titles, words[0])
+		words = words[1:]
+	}
+	*first = strings.Join(words, " ")
+
+	words = strings.Fields(strings.ReplaceAll(*last, ",", " , "))
+	var suffixes []string
+	for len(words) > 1 {
+		word := words[len(words)-1]
+		if word == "," {
+			words = words[:len(words)-1]
+			continue
+		}
+		if !p.suffixes[normalizeNameToken(word)] {
+			break
+		}
+		suffixes = append([]string{word}, suffixes...)
+		words = words[:len(words)-1]
+	}
+	// Commas were split off as words of their own, they go back where
+	// they were in the remaining name.
+	*last = strings.ReplaceAll(strings.Join(words, " "), " ,", ",")
+	m.Title = strings.Join(titles, " ")
+	m.Suffix = strings.Join(suffixes, ", ")
+}
+
+// displayName is the member's name as shown on cards, with any title and
+// suffix.
+func (m Member) displayName() string {
+	name := strings.Join(strings.Fields(m.Title+" "+m.FirstName+" "+m.LastName), " ")
+	if m.Suffix != "" {
+		name += ", " + m.Suffix
+	}
+	return name
+}
@@ -0,0 +1,50 @@
+package main
+
+import "testing"
+
+func TestNameParts(t *testing.T) {
+	tests := []struct {
+		name                 string
+		titles, suffixes     string
+		first, last          string
+		wantTitle, wantFirst string
+		wantLast, wantSuffix string
+		wantDisplay          string
+	}{
+		{"plain", "", "", "Jane", "Smith", "", "Jane", "Smith", "", "Jane Smith"},
+		{"title", "", "", "Dr. Jane", "Smith", "Dr.", "Jane", "Smith", "", "Dr. Jane Smith"},
+		{"title and suffix", "", "", "Dr. Jane", "Smith, PhD", "Dr.", "Jane", "Smith", "PhD", "Dr. Jane Smith, PhD"},
+		{"several titles and suffixes", "", "", "Prof. Dr Jane", "Smith Jr., PhD", "Prof. Dr", "Jane", "Smith", "Jr., PhD", "Prof. Dr Jane Smith, Jr., PhD"},
+		{"case-insensitive", "", "", "mme Jeanne", "Martin", "mme", "Jeanne", "Martin", "", "mme Jeanne Martin"},
+		{"whole name in one column", "", "", "Dr. Jane Smith, PhD", "", "Dr.", "Jane Smith", "", "PhD", "Dr. Jane Smith, PhD"},
+		{"a title alone is the name", "", "", "Dr", "Who", "", "Dr", "Who", "", "Dr Who"},
+		{"a suffix alone is the name", "", "", "Jane", "Esq", "", "Jane", "Esq", "", "Jane Esq"},
+		{"names that look like tokens", "", "", "Marie", "Ivanova", "", "Marie", "Ivanova", "", "Marie Ivanova"},
+		{"configured tokens", "Sir,Dame", "KBE,OBE", "Dame Judi", "Dench OBE", "Dame", "Judi", "Dench", "OBE", "Dame Judi Dench, OBE"},
+		{"configured tokens replace the defaults", "Sir", "KBE", "Dr. Jane", "Smith, PhD", "", "Dr. Jane", "Smith, PhD", "", "Dr. Jane Smith, PhD"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("PARSE_NAME_TITLES", "true")
+			t.Setenv("NAME_TITLES", tt.titles)
+			t.Setenv("NAME_SUFFIXES", tt.suffixes)
+			m := Member{FirstName: tt.first, LastName: tt.last}
+			loadNameParts().apply(&m)
+			if m.Title != tt.wantTitle || m.FirstName != tt.wantFirst || m.LastName != tt.wantLast || m.Suffix != tt.wantSuffix {
+				t.Errorf("apply() = %q / %q / %q / %q, want %q / %q / %q / %q", m.Title, m.FirstName, m.LastName, m.Suffix, tt.wantTitle, tt.wantFirst, tt.wantLast, tt.wantSuffix)
+			}
+			if got := m.displayName(); got != tt.wantDisplay {
+				t.Errorf("displayName() = %q, want %q", got, tt.wantDisplay)
+			}
+		})
+	}
+}
+
+func TestNamePartsAreOptIn(t *testing.T) {
+	t.Setenv("PARSE_NAME_TITLES", "")
+	m := Member{FirstName: "Dr. Jane", LastName: "Smith, PhD"}
+	loadNameParts().apply(&m)
+	if m.FirstName != "Dr. Jane" || m.LastName != "Smith, PhD" || m.Title != "" || m.Suffix != "" {
+		t.Errorf("names were split without PARSE_NAME_TITLES: %+v", m)
+	}
+}
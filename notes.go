@@ -0,0 +1,149 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	texttemplate "text/template"
+)
+
+// Lengths past which Wallet cuts card text off on the details screen.
+const (
+	noteHeaderLimit = 40
+	noteBodyLimit   = 500
+)
+
+type CardNote struct {
+	Header string `json:"header"`
+	Body   string `json:"body"`
+}
+
+type CardLink struct {
+	ID          string `json:"-"`
+	Description string `json:"description"`
+	URI         string `json:"uri"`
+}
+
+type noteSet struct {
+	Notes []CardNote `json:"notes"`
+	Links []CardLink `json:"links"`
+}
+
+// cardNotes is the back of the card content: the program notes and links,
+// followed by those of the member's tier. Headers and bodies are templates
+// over the member, e.g. "Welcome {{.FirstName}}" or {{.Field "chapter"}}.
+type cardNotes struct {
+	noteSet
+	Tiers map[string]noteSet `json:"tiers"`
+}
+
+// noteMember is the data card notes are rendered with.
+type noteMember struct {
+	Member
+}
+
+func (m noteMember) Field(name string) string {
+	return strings.Join(memberFieldValues(m.Member, name), ", ")
+}
+
+// loadCardNotes reads the CARD_NOTES JSON file; without one cards have no
+// back content.
+func loadCardNotes() (cardNotes, error) {
+	path := os.Getenv("CARD_NOTES")
+	if path == "" {
+		return cardNotes{}, nil
+	}
+	notesBytes, err := os.ReadFile(path)
+	if err != nil {
+		return cardNotes{}, fmt.Errorf("error reading card notes file: %v", err)
+	}
+	var notes cardNotes
+	if err := json.Unmarshal(notesBytes, &notes); err != nil {
+		return cardNotes{}, fmt.Errorf("error parsing card notes file: %v", err)
+	}
+	sets := []noteSet{notes.noteSet}
+	for _, set := range notes.Tiers {
+		sets = append(sets, set)
+	}
+	for _, set := range sets {
+		for _, link := range set.Links {
+			if !validHttpsUrl(link.URI) {
+				return cardNotes{}, fmt.Errorf("card notes link %q must be an https URL", link.URI)
+			}
+		}
+	}
+	return notes, nil
+}
+
+// renderNoteText renders a note template for a member, cutting it to limit
+// characters.
+func renderNoteText(text string, m Member, limit int) (string, error) {
+	t, err := texttemplate.New("note").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("error parsing card note %q: %v", text, err)
+	}
+	output, err := executeLimited(t, noteMember{m})
+	if err != nil {
+		return "", fmt.Errorf("error rendering card note %q: %v", text, err)
+	}
+	rendered := []rune(strings.TrimSpace(string(output)))
+	if len(rendered) > limit {
+		log.Printf("Warning: card note for member %s cut to %d characters", m.ID, limit)
+		rendered = append(rendered[:limit-1], '…')
+	}
+	return string(rendered), nil
+}
+
+// backContent renders the card notes of a member as text modules, after the
+// ones of the card layout, and links.
+func (notes cardNotes) backContent(m Member) ([]TextModule, []CardLink, error) {
+	sets := []noteSet{notes.noteSet}
+	if tier, ok := notes.Tiers[strings.ToLower(m.Extra["tier"])]; ok {
+		sets = append(sets, tier)
+	}
+	var modules []TextModule
+	var links []CardLink
+	for _, set := range sets {
+		for _, note := range set.Notes {
+			header, err := renderNoteText(note.Header, m, noteHeaderLimit)
+			if err != nil {
+				return nil, nil, err
+			}
+			body, err := renderNoteText(note.Body, m, noteBodyLimit)
+			if err != nil {
+				return nil, nil, err
+			}
+			modules = append(modules, TextModule{ID: fmt.Sprintf("note_%d", len(modules)+1), Header: header, Body: body})
+		}
+		for _, link := range set.Links {
+			description, err := renderNoteText(link.Description, m, noteHeaderLimit)
+			if err != nil {
+				return nil, nil, err
+			}
+			links = append(links, CardLink{ID: fmt.Sprintf("link_%d", len(links)+1), Description: description, URI: link.URI})
+		}
+	}
+	return modules, links, nil
+}
+
+// complianceLinks are the TERMS_URL and PRIVACY_URL links, each left out
+// when unset.
+func complianceLinks(labels CardLabels) ([]CardLink, error) {
+	var links []CardLink
+	for _, link := range []struct{ id, name, description string }{
+		{"terms", "TERMS_URL", labels.Terms},
+		{"privacy", "PRIVACY_URL", labels.Privacy},
+	} {
+		uri := os.Getenv(link.name)
+		if uri == "" {
+			continue
+		}
+		if !validHttpsUrl(uri) {
+			return nil, fmt.Errorf("%s must be an https URL, got %q", link.name, uri)
+		}
+		links = append(links, CardLink{ID: link.id, Description: link.description, URI: uri})
+	}
+	return links, nil
+}
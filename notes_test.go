@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCardTextModulesCapped(t *testing.T) {
+	var notes cardNotes
+	for i := 0; i < 12; i++ {
+		notes.Notes = append(notes.Notes, CardNote{Header: fmt.Sprintf("Note %d", i), Body: "Body"})
+	}
+	content, err := json.Marshal(notes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "notes.json")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+	member := Member{ID: "a1", FirstName: "Jane", LastName: "Doe"}
+	now := date("2026-10-14")
+	front, err := newCardData(member, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("CARD_NOTES", path)
+	card, err := newCardData(member, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	limit := regionMaxFields("text")
+	if len(card.TextModules) != limit {
+		t.Fatalf("card has %d text modules, want %d", len(card.TextModules), limit)
+	}
+	for i, module := range card.TextModules {
+		want := "Body"
+		if i < len(front.TextModules) {
+			want = front.TextModules[i].Body
+		}
+		if module.Body != want {
+			t.Errorf("text module %d is %+v, want the layout fields first, then notes", i, module)
+		}
+	}
+}
+
+func TestComplianceLinks(t *testing.T) {
+	serveRosterCsv(t, cardRoster)
+	useSchema(t, apiSchema)
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+	tests := []struct {
+		name       string
+		terms      string
+		privacy    string
+		wantStatus int
+		wantLinks  []string
+	}{
+		{"unset", "", "", http.StatusOK, nil},
+		{"both", "https://club.example/terms", "https://club.example/privacy", http.StatusOK, []string{
+			"terms https://club.example/terms Conditions d’utilisation",
+			"privacy https://club.example/privacy Politique de confidentialité",
+		}},
+		{"privacy only", "", "https://club.example/privacy", http.StatusOK, []string{
+			"privacy https://club.example/privacy Politique de confidentialité",
+		}},
+		{"plain http", "http://club.example/terms", "", http.StatusInternalServerError, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TERMS_URL", tt.terms)
+			t.Setenv("PRIVACY_URL", tt.privacy)
+			rec := requestGoogleCard(t, "id=a1")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			var card struct {
+				LinksModuleData *struct {
+					Uris []struct {
+						ID          string `json:"id"`
+						URI         string `json:"uri"`
+						Description string `json:"description"`
+					} `json:"uris"`
+				} `json:"linksModuleData"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &card); err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantLinks == nil {
+				if card.LinksModuleData != nil {
+					t.Errorf("links module %+v, want none", card.LinksModuleData)
+				}
+				return
+			}
+			var links []string
+			if card.LinksModuleData != nil {
+				for _, link := range card.LinksModuleData.Uris {
+					links = append(links, link.ID+" "+link.URI+" "+link.Description)
+				}
+			}
+			if !reflect.DeepEqual(links, tt.wantLinks) {
+				t.Errorf("links %q, want %q", links, tt.wantLinks)
+			}
+		})
+	}
+}
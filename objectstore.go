@@ -0,0 +1,191 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// objectStore is a bucket service reached through the S3 API with AWS
+// Signature Version 4, which Google Cloud Storage also accepts with HMAC
+// keys. It lets CSV_URL be an s3://bucket/key or gs://bucket/key object.
+type objectStore struct {
+	endpoint  string
+	region    string
+	accessKey string
+	secretKey string
+	token     string
+	// virtualHost puts the bucket in the host name rather than the path.
+	virtualHost bool
+}
+
+// emptyPayloadHash is the SHA-256 of the empty body of GET requests.
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// objectStoreFor reads the credentials for a URL scheme: AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY, the optional AWS_SESSION_TOKEN and AWS_REGION
+// (default us-east-1) for s3, and the GCS_HMAC_ACCESS_ID and GCS_HMAC_SECRET
+// interoperability keys for gs. S3_ENDPOINT and GCS_ENDPOINT point at
+// another compatible service, addressed with the bucket in the path.
+func objectStoreFor(scheme string) (objectStore, error) {
+	var store objectStore
+	switch scheme {
+	case "s3":
+		store = objectStore{
+			endpoint:    os.Getenv("S3_ENDPOINT"),
+			region:      os.Getenv("AWS_REGION"),
+			accessKey:   os.Getenv("AWS_ACCESS_KEY_ID"),
+			secretKey:   os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			token:       os.Getenv("AWS_SESSION_TOKEN"),
+			virtualHost: os.Getenv("S3_ENDPOINT") == "",
+		}
+		if store.region == "" {
+			store.region = "us-east-1"
+		}
+		if store.endpoint == "" {
+			store.endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", store.region)
+		}
+		if store.accessKey == "" || store.secretKey == "" {
+			return objectStore{}, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set to read from S3")
+		}
+	case "gs":
+		store = objectStore{
+			endpoint:  os.Getenv("GCS_ENDPOINT"),
+			region:    "auto",
+			accessKey: os.Getenv("GCS_HMAC_ACCESS_ID"),
+			secretKey: os.Getenv("GCS_HMAC_SECRET"),
+		}
+		if store.endpoint == "" {
+			store.endpoint = "https://storage.googleapis.com"
+		}
+		if store.accessKey == "" || store.secretKey == "" {
+			return objectStore{}, fmt.Errorf("GCS_HMAC_ACCESS_ID and GCS_HMAC_SECRET must be set to read from GCS")
+		}
+	default:
+		return objectStore{}, fmt.Errorf("unsupported object storage scheme %q", scheme)
+	}
+	return store, nil
+}
+
+// awsEscape percent-encodes everything but unreserved characters and, when
+// keepSlash is set, slashes, as SigV4 canonical requests expect.
+func awsEscape(value string, keepSlash bool) string {
+	var escaped strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', strings.IndexByte("-._~", b) >= 0:
+			escaped.WriteByte(b)
+		case b == '/' && keepSlash:
+			escaped.WriteByte(b)
+		default:
+			fmt.Fprintf(&escaped, "%%%02X", b)
+		}
+	}
+	return escaped.String()
+}
+
+func hmacSha256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// sign adds a SigV4 Authorization header to a body-less request, covering the
+// host and every header already set on it.
+func (s objectStore) sign(req *http.Request, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	day := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptyPayloadHash)
+	if s.token != "" {
+		req.Header.Set("X-Amz-Security-Token", s.token)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	var query []string
+	for name, values := range req.URL.Query() {
+		for _, value := range values {
+			query = append(query, awsEscape(name, false)+"="+awsEscape(value, false))
+		}
+	}
+	sort.Strings(query)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsEscape(req.URL.Path, true),
+		strings.Join(query, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptyPayloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := day + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSha256([]byte("AWS4"+s.secretKey), day)
+	key = hmacSha256(key, s.region)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKey, scope, signedHeaders, signature))
+}
+
+// objectRequest builds the signed GET request for a bucket object.
+func (s objectStore) objectRequest(bucket, key string) (*http.Request, error) {
+	endpoint, err := url.Parse(s.endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid object storage endpoint %q: %v", s.endpoint, err)
+	}
+	if s.virtualHost {
+		endpoint.Host = bucket + "." + endpoint.Host
+		endpoint.Path = "/" + key
+	} else {
+		endpoint.Path = strings.TrimRight(endpoint.Path, "/") + "/" + bucket + "/" + key
+	}
+	endpoint.RawPath = awsEscape(endpoint.Path, true)
+	req, err := http.NewRequest(http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	s.sign(req, time.Now())
+	return req, nil
+}
+
+// getUrl fetches an http(s) URL, or an s3:// or gs:// object with the
+// bucket credentials.
+func getUrl(client *http.Client, rawUrl string) (*http.Response, error) {
+	parsed, err := url.Parse(rawUrl)
+	if err != nil || (parsed.Scheme != "s3" && parsed.Scheme != "gs") {
+		return client.Get(rawUrl)
+	}
+	store, err := objectStoreFor(parsed.Scheme)
+	if err != nil {
+		return nil, err
+	}
+	req, err := store.objectRequest(parsed.Host, strings.TrimPrefix(parsed.Path, "/"))
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	_ "image/png"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Member photos are scaled down to fit the card hero image, 1032x336.
+// Photos larger than 24 megapixels or 10000 pixels on a side are refused
+// before decoding, a small file can declare a huge image.
+const (
+	photoMaxWidth        = 1032
+	photoMaxHeight       = 336
+	photoMaxSourceSide   = 10000
+	photoMaxSourcePixels = 24_000_000
+)
+
+// photoProxyBaseUrl reads PHOTO_PROXY_BASE_URL, the public https URL of this
+// server. When set, cards point at /photo/{id} instead of member photo URLs,
+// so Wallet never waits on the hosts the photos live on.
+func photoProxyBaseUrl() (string, error) {
+	base := strings.TrimRight(os.Getenv("PHOTO_PROXY_BASE_URL"), "/")
+	if base != "" && !validHttpsUrl(base) {
+		return "", fmt.Errorf("PHOTO_PROXY_BASE_URL must be an https URL, got %q", base)
+	}
+	return base, nil
+}
+
+func photoCacheTtl() (time.Duration, error) {
+	return durationFromEnv("PHOTO_CACHE_TTL", 24*time.Hour)
+}
+
+// photoMaxBytes reads PHOTO_MAX_BYTES, the largest photo fetched (default
+// 5 MiB).
+func photoMaxBytes() (int64, error) {
+	value := os.Getenv("PHOTO_MAX_BYTES")
+	if value == "" {
+		return 5 << 20, nil
+	}
+	limit, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || limit <= 0 {
+		return 0, fmt.Errorf("PHOTO_MAX_BYTES must be a positive number of bytes, got %q", value)
+	}
+	return limit, nil
+}
+
+type cachedPhoto struct {
+	source    string
+	jpeg      []byte
+	fetchedAt time.Time
+}
+
+// photoCache holds resized photos by member ID. An entry is refetched once
+// it expires or when the member's photo URL changes.
+var photoCache struct {
+	sync.Mutex
+	photos map[string]cachedPhoto
+}
+
+var photoContentTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+}
+
+// fetchPhoto downloads a photo and returns it as a JPEG that fits the card.
+func fetchPhoto(source string) ([]byte, error) {
+	client, err := outboundClient("PHOTO_FETCH_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	maxBytes, err := photoMaxBytes()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Get(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("error fetching photo: %s", resp.Status)
+	}
+	contentType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	if !photoContentTypes[strings.TrimSpace(contentType)] {
+		return nil, fmt.Errorf("photo has unsupported content type %q", contentType)
+	}
+	content, err := io.ReadAll(io.LimitReader(resp.Body, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(content)) > maxBytes {
+		return nil, fmt.Errorf("photo is larger than %d bytes", maxBytes)
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding photo: %v", err)
+	}
+	if config.Width > photoMaxSourceSide || config.Height > photoMaxSourceSide || config.Width*config.Height > photoMaxSourcePixels {
+		return nil, fmt.Errorf("photo is %dx%d pixels, larger than accepted", config.Width, config.Height)
+	}
+	photo, _, err := image.Decode(bytes.NewReader(content))
+	if err != nil {
+		return nil, fmt.Errorf("error decoding photo: %v", err)
+	}
+	var output bytes.Buffer
+	if err := jpeg.Encode(&output, fitPhoto(photo), &jpeg.Options{Quality: 85}); err != nil {
+		return nil, err
+	}
+	return output.Bytes(), nil
+}
+
+// fitPhoto scales a photo down, keeping its aspect ratio, with nearest
+// neighbour sampling; photos that already fit are left as they are.
+func fitPhoto(photo image.Image) image.Image {
+	bounds := photo.Bounds()
+	scale := min(float64(photoMaxWidth)/float64(bounds.Dx()), float64(photoMaxHeight)/float64(bounds.Dy()))
+	if scale >= 1 {
+		return photo
+	}
+	width, height := max(1, int(float64(bounds.Dx())*scale)), max(1, int(float64(bounds.Dy())*scale))
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			resized.Set(x, y, photo.At(bounds.Min.X+int(float64(x)/scale), bounds.Min.Y+int(float64(y)/scale)))
+		}
+	}
+	return resized
+}
+
+func memberPhoto(m Member, source string) ([]byte, error) {
+	ttl, err := photoCacheTtl()
+	if err != nil {
+		return nil, err
+	}
+	photoCache.Lock()
+	cached, ok := photoCache.photos[m.ID]
+	photoCache.Unlock()
+	if ok && cached.source == source && time.Since(cached.fetchedAt) < ttl {
+		return cached.jpeg, nil
+	}
+
+	content, err := fetchPhoto(source)
+	if err != nil {
+		return nil, err
+	}
+	photoCache.Lock()
+	defer photoCache.Unlock()
+	if photoCache.photos == nil {
+		photoCache.photos = map[string]cachedPhoto{}
+	}
+	photoCache.photos[m.ID] = cachedPhoto{source: source, jpeg: content, fetchedAt: time.Now()}
+	return content, nil
+}
+
+// photoHandler serves a member's photo, resized and cached, for the card
+// image Wallet fetches.
+func photoHandler(w http.ResponseWriter, r *http.Request) {
+	members, ok := serveRoster(w)
+	if !ok {
+		return
+	}
+	member, ok := findMember(members, r.PathValue("id"))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	source, isPhoto, err := cardImageSource(member)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !isPhoto {
+		http.NotFound(w, r)
+		return
+	}
+	content, err := memberPhoto(member, source)
+	if err != nil {
+		http.Error(w, "Error fetching member photo: "+err.Error(), http.StatusBadGateway)
+		return
+	}
+	w.Header().Set("Content-Type", "image/jpeg")
+	w.Header().Set("Cache-Control", "public, max-age=3600")
+	w.Write(content)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// pngHeader is the start of a PNG declaring a width and height, all the
+// decoder reads before allocating the image.
+func pngHeader(width, height uint32) []byte {
+	var ihdr bytes.Buffer
+	ihdr.WriteString("IHDR")
+	binary.Write(&ihdr, binary.BigEndian, width)
+	binary.Write(&ihdr, binary.BigEndian, height)
+	ihdr.Write([]byte{8, 6, 0, 0, 0})
+
+	var file bytes.Buffer
+	file.WriteString("\x89PNG\r\n\x1a\n")
+	binary.Write(&file, binary.BigEndian, uint32(ihdr.Len()-4))
+	file.Write(ihdr.Bytes())
+	binary.Write(&file, binary.BigEndian, crc32.ChecksumIEEE(ihdr.Bytes()))
+	return file.Bytes()
+}
+
+func servePhoto(t *testing.T, content []byte) string {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(content)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+func TestFetchPhotoResizes(t *testing.T) {
+	var photo bytes.Buffer
+	if err := png.Encode(&photo, image.NewRGBA(image.Rect(0, 0, 2064, 336))); err != nil {
+		t.Fatal(err)
+	}
+	content, err := fetchPhoto(servePhoto(t, photo.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, format, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format != "jpeg" || config.Width != 1032 || config.Height != 168 {
+		t.Errorf("got a %dx%d %s, want a 1032x168 jpeg", config.Width, config.Height, format)
+	}
+}
+
+func TestFetchPhotoRefusesHugeImages(t *testing.T) {
+	tests := []struct {
+		name          string
+		width, height uint32
+	}{
+		{"huge", 50000, 50000},
+		{"too wide", 20000, 10},
+		{"too many pixels", 6000, 6000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := fetchPhoto(servePhoto(t, pngHeader(tt.width, tt.height)))
+			if err == nil || !strings.Contains(err.Error(), "larger than accepted") {
+				t.Errorf("fetching a %dx%d photo: %v, want it refused for its size", tt.width, tt.height, err)
+			}
+		})
+	}
+}
+
+func TestPhotoHandlerCaches(t *testing.T) {
+	var photo bytes.Buffer
+	if err := png.Encode(&photo, image.NewRGBA(image.Rect(0, 0, 40, 30))); err != nil {
+		t.Fatal(err)
+	}
+	var fetches atomic.Int32
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fetches.Add(1)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(photo.Bytes())
+	}))
+	defer server.Close()
+	// Photos are fetched with the default transport, which has to trust the
+	// test server.
+	transport := http.DefaultTransport
+	http.DefaultTransport = server.Client().Transport
+	t.Cleanup(func() { http.DefaultTransport = transport })
+	photoCache.Lock()
+	photoCache.photos = nil
+	photoCache.Unlock()
+
+	roster := func(janePhoto string) string {
+		return "id,first_name,last_name,email,photo_url,join_date\n" +
+			"a1,Jane,Doe,jane@example.com," + janePhoto + ",2026-03-01\n" +
+			"a2,John,Roe,john@example.com,,2026-03-01\n"
+	}
+	useSchema(t, `{"columns": [
+		{"name": "id", "header": "id", "type": "string"},
+		{"name": "first_name", "header": "first_name", "type": "string"},
+		{"name": "last_name", "header": "last_name", "type": "string"},
+		{"name": "email", "header": "email", "type": "email"},
+		{"name": "photo_url", "header": "photo_url", "type": "string"},
+		{"name": "join_date", "header": "join_date", "type": "date"}
+	]}`)
+	t.Setenv("CARD_IMAGE_FALLBACK", "photo_url,https://images.example/logo.png")
+	get := func(id string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/photo/"+id, nil)
+		req.SetPathValue("id", id)
+		rec := httptest.NewRecorder()
+		photoHandler(rec, req)
+		return rec
+	}
+
+	serveRosterCsv(t, roster(server.URL+"/jane.png"))
+	first := get("a1")
+	if first.Code != http.StatusOK || first.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("status %d, Content-Type %q: %s", first.Code, first.Header().Get("Content-Type"), first.Body)
+	}
+	if _, format, err := image.DecodeConfig(bytes.NewReader(first.Body.Bytes())); err != nil || format != "jpeg" {
+		t.Errorf("served photo: %s, %v, want a jpeg", format, err)
+	}
+	if again := get("a1"); again.Code != http.StatusOK || !bytes.Equal(again.Body.Bytes(), first.Body.Bytes()) || fetches.Load() != 1 {
+		t.Errorf("second request: status %d, %d fetches, want the cached photo", again.Code, fetches.Load())
+	}
+
+	serveRosterCsv(t, roster(server.URL+"/jane-2026.png"))
+	if get("a1"); fetches.Load() != 2 {
+		t.Errorf("%d fetches after the photo URL changed, want 2", fetches.Load())
+	}
+	t.Setenv("PHOTO_CACHE_TTL", "1ns")
+	if get("a1"); fetches.Load() != 3 {
+		t.Errorf("%d fetches after the cache expired, want 3", fetches.Load())
+	}
+
+	for _, id := range []string{"a2", "zz"} {
+		if rec := get(id); rec.Code != http.StatusNotFound {
+			t.Errorf("photo of %s: status %d, want 404", id, rec.Code)
+		}
+	}
+}
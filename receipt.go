@@ -0,0 +1,46 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CardReceipt is what integrators get back for a generated card instead of
+// the card itself. SaveLink is empty until the card is saved to Wallet.
+type CardReceipt struct {
+	MemberID   string    `json:"member_id"`
+	Platform   string    `json:"platform"`
+	ObjectID   string    `json:"object_id"`
+	IssuedAt   time.Time `json:"issued_at"`
+	Expiration string    `json:"expiration,omitempty"`
+	SaveLink   string    `json:"save_link,omitempty"`
+}
+
+// wantsJsonReceipt tells API clients, asking for application/json, from
+// browsers.
+func wantsJsonReceipt(r *http.Request) bool {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err == nil && mediaType == "application/json" {
+			return true
+		}
+	}
+	return false
+}
+
+func newCardReceipt(m Member, platform, payload string, card CardData, issuedAt time.Time) (CardReceipt, error) {
+	saveLink, err := generateGoogleCard(payload)
+	if err != nil {
+		return CardReceipt{}, err
+	}
+	return CardReceipt{
+		MemberID:   m.ID,
+		Platform:   platform,
+		ObjectID:   card.ObjectID,
+		IssuedAt:   issuedAt.UTC(),
+		Expiration: card.PassExpiration,
+		SaveLink:   saveLink,
+	}, nil
+}
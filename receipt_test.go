@@ -0,0 +1,126 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGoogleObjectId(t *testing.T) {
+	tests := []struct {
+		classId string
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{classId: "3388000000012345678.membership", id: "907d7bf93d60", want: "3388000000012345678.907d7bf93d60"},
+		{classId: "3388000000012345678.membership", id: "A-12_b.c", want: "3388000000012345678.A-12_b.c"},
+		{classId: "3388000000012345678.membership", id: "jane doe", want: "3388000000012345678.member-ed37d99b1445238af3386f81a77a2caf"},
+		{classId: "membership", id: "1", wantErr: true},
+		{classId: ".membership", id: "1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := googleObjectId(tt.classId, Member{ID: tt.id})
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("googleObjectId(%q, %q) = %q, want an error", tt.classId, tt.id, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("googleObjectId(%q, %q) = %q, %v, want %q", tt.classId, tt.id, got, err, tt.want)
+		}
+	}
+}
+
+// Each member's receipt and card payload carry the member's own object ID.
+func TestCardReceiptObjectIds(t *testing.T) {
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.membership")
+	now := date("2026-10-14")
+	seen := map[string]bool{}
+	for _, m := range []Member{
+		{ID: "a1", FirstName: "Ada", ExpirationDate: date("2027-01-01")},
+		{ID: "b2", FirstName: "Grace", ExpirationDate: date("2027-01-01")},
+	} {
+		card, err := newCardData(m, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload, err := renderJsonTemplate("./google_card.json", card)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var object struct {
+			ID      string `json:"id"`
+			ClassID string `json:"classId"`
+		}
+		if err := json.Unmarshal([]byte(payload), &object); err != nil {
+			t.Fatalf("payload is not JSON: %v\n%s", err, payload)
+		}
+		receipt, err := newCardReceipt(m, "google", payload, card, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := "3388000000012345678." + m.ID
+		if object.ID != want || receipt.ObjectID != want || object.ClassID != "3388000000012345678.membership" {
+			t.Errorf("member %s: payload id %q, class %q, receipt object_id %q, want %q", m.ID, object.ID, object.ClassID, receipt.ObjectID, want)
+		}
+		if seen[receipt.ObjectID] {
+			t.Errorf("object_id %q given to two members", receipt.ObjectID)
+		}
+		seen[receipt.ObjectID] = true
+	}
+}
+
+// The JSON receipt describes the very card browsers get.
+func TestCardReceiptMatchesBrowserCard(t *testing.T) {
+	serveRosterCsv(t, cardRoster)
+	useSchema(t, apiSchema)
+	t.Setenv("GOOGLE_CLASS_ID", "3388000000012345678.members")
+	request := func(accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/card/generate_google?id=a1", nil)
+		req.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		generateGoogleCardHandler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Accept %q: status %d: %s", accept, rec.Code, rec.Body)
+		}
+		return rec
+	}
+
+	browser := request("text/html,application/xhtml+xml;q=0.9,*/*;q=0.8")
+	var card struct {
+		ID                string `json:"id"`
+		ValidTimeInterval struct {
+			End struct {
+				Date string `json:"date"`
+			} `json:"end"`
+		} `json:"validTimeInterval"`
+	}
+	if err := json.Unmarshal(browser.Body.Bytes(), &card); err != nil {
+		t.Fatalf("the browser got no card payload: %v\n%s", err, browser.Body)
+	}
+
+	before := time.Now().UTC()
+	api := request("application/json")
+	if api.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("receipt Content-Type %q", api.Header().Get("Content-Type"))
+	}
+	var receipt CardReceipt
+	decoder := json.NewDecoder(api.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&receipt); err != nil {
+		t.Fatal(err)
+	}
+	if receipt.MemberID != "a1" || receipt.Platform != "google" || receipt.ObjectID != card.ID || receipt.Expiration != card.ValidTimeInterval.End.Date {
+		t.Errorf("receipt %+v, want member a1 on google with the card's object %q and expiration %q", receipt, card.ID, card.ValidTimeInterval.End.Date)
+	}
+	if card.ID != "3388000000012345678.a1" || card.ValidTimeInterval.End.Date == "" {
+		t.Errorf("card object %q, expiration %q", card.ID, card.ValidTimeInterval.End.Date)
+	}
+	if receipt.IssuedAt.Before(before.Add(-time.Second)) || receipt.IssuedAt.After(time.Now().Add(time.Second)) {
+		t.Errorf("receipt issued at %s, want now", receipt.IssuedAt)
+	}
+}
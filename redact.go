@@ -0,0 +1,83 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// redactedFields reads REDACT_FIELDS, the comma separated member fields
+// (e.g. "email,phone") masked in logs and in API responses to callers
+// without the privileged token.
+func redactedFields() map[string]bool {
+	fields := map[string]bool{}
+	for _, field := range splitList(os.Getenv("REDACT_FIELDS"), ",") {
+		fields[field] = true
+	}
+	return fields
+}
+
+// maskValue keeps just enough of a value to recognise it: the first letter
+// and the domain of an email (j***@example.com), the first letter otherwise.
+func maskValue(value string) string {
+	if value == "" {
+		return ""
+	}
+	local, domain, isEmail := strings.Cut(value, "@")
+	first := ""
+	if runes := []rune(local); len(runes) > 0 {
+		first = string(runes[0])
+	}
+	if isEmail {
+		return first + "***@" + domain
+	}
+	return first + "***"
+}
+
+// redactMember masks the member fields named in fields, looked up like the
+// API filters look them up. Dates are not masked.
+func redactMember(m Member, fields map[string]bool) Member {
+	for field := range fields {
+		if text := memberTextField(&m, field); text != nil {
+			*text = maskValue(*text)
+		}
+	}
+	// Copy the maps, the roster cache shares them.
+	if m.Extra != nil {
+		extra := make(map[string]string, len(m.Extra))
+		for name, value := range m.Extra {
+			if fields[name] {
+				value = maskValue(value)
+			}
+			extra[name] = value
+		}
+		m.Extra = extra
+	}
+	if m.Lists != nil {
+		lists := make(map[string][]string, len(m.Lists))
+		for name, values := range m.Lists {
+			if fields[name] {
+				masked := make([]string, len(values))
+				for i, value := range values {
+					masked[i] = maskValue(value)
+				}
+				values = masked
+			}
+			lists[name] = values
+		}
+		m.Lists = lists
+	}
+	return m
+}
+
+// privilegedRequest is true when the request carries API_PRIVILEGED_TOKEN as
+// a bearer token, which gives access to unredacted member data.
+func privilegedRequest(r *http.Request) bool {
+	token := os.Getenv("API_PRIVILEGED_TOKEN")
+	if token == "" {
+		return false
+	}
+	given, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return found && subtle.ConstantTimeCompare([]byte(given), []byte(token)) == 1
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMaskValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"", ""},
+		{"jane@example.com", "j***@example.com"},
+		{"@example.com", "***@example.com"},
+		{"élodie@example.fr", "é***@example.fr"},
+		{"0601020304", "0***"},
+		{"Ådne", "Å***"},
+	}
+	for _, tt := range tests {
+		if got := maskValue(tt.value); got != tt.want {
+			t.Errorf("maskValue(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestRedactMember(t *testing.T) {
+	member := Member{
+		ID:        "a1",
+		Title:     "Dr",
+		FirstName: "Jane",
+		LastName:  "Doe",
+		Suffix:    "Jr",
+		Email:     "jane@example.com",
+		Language:  "fr",
+		Extra:     map[string]string{"phone": "0601020304", "tier": "gold"},
+		Lists:     map[string][]string{"roles": {"board", "treasurer"}},
+	}
+	redacted := redactMember(member, map[string]bool{
+		"title": true, "last_name": true, "suffix": true, "email": true, "language": true,
+		"phone": true, "roles": true, "join_date": true,
+	})
+
+	want := Member{
+		ID:        "a1",
+		Title:     "D***",
+		FirstName: "Jane",
+		LastName:  "D***",
+		Suffix:    "J***",
+		Email:     "j***@example.com",
+		Language:  "f***",
+		Extra:     map[string]string{"phone": "0***", "tier": "gold"},
+		Lists:     map[string][]string{"roles": {"b***", "t***"}},
+	}
+	if !reflect.DeepEqual(redacted, want) {
+		t.Errorf("redactMember() = %+v, want %+v", redacted, want)
+	}
+	if member.Extra["phone"] != "0601020304" || member.Lists["roles"][0] != "board" {
+		t.Errorf("redactMember() changed the roster member: %+v", member)
+	}
+}
@@ -0,0 +1,637 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/mail"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Column maps one CSV column to a logical member field. A column is located
+// either by its zero-based Index or by its Header name in the first row.
+// List columns hold several values in one cell, split on Separator. Default
+// fills in cells left empty, before the value is parsed. Normalize cleans
+// up cells first, one step after the other. Number columns read Decimal, "."
+// or ",", as the decimal separator, NUMBER_DECIMAL_SEPARATOR (default ".")
+// when unset, and strip the currency symbols and codes in Currency.
+type Column struct {
+	Name      string       `json:"name"`
+	Index     *int         `json:"index,omitempty"`
+	Header    string       `json:"header,omitempty"`
+	Type      string       `json:"type"`
+	Separator string       `json:"separator,omitempty"`
+	Default   string       `json:"default,omitempty"`
+	Decimal   string       `json:"decimal,omitempty"`
+	Currency  []string     `json:"currency,omitempty"`
+	Normalize []Normalizer `json:"normalize,omitempty"`
+}
+
+// Normalizer is one cleanup step of a column:
+//
+//	{"step": "trim"}   strips surrounding spaces
+//	{"step": "lower"}  lowercases
+//	{"step": "upper"}  uppercases
+//	{"step": "replace", "pattern": "^\\+33 ?", "with": "0"}
+//	                   replaces regexp matches, $1 in "with" being the first group
+type Normalizer struct {
+	Step    string `json:"step"`
+	Pattern string `json:"pattern,omitempty"`
+	With    string `json:"with,omitempty"`
+	pattern *regexp.Regexp
+}
+
+func (n Normalizer) apply(value string) string {
+	switch n.Step {
+	case "trim":
+		return strings.TrimSpace(value)
+	case "lower":
+		return strings.ToLower(value)
+	case "upper":
+		return strings.ToUpper(value)
+	case "replace":
+		return n.pattern.ReplaceAllString(value, n.With)
+	}
+	return value
+}
+
+type Schema struct {
+	Columns []Column `json:"columns"`
+}
+
+var columnTypes = map[string]bool{
+	"string": true,
+	"date":   true,
+	"bool":   true,
+	"phone":  true,
+	"email":  true,
+	"list":   true,
+	"number": true,
+}
+
+func intPtr(i int) *int {
+	return &i
+}
+
+// defaultSchema matches the layout of the Google Form export we started with.
+var defaultSchema = Schema{
+	Columns: []Column{
+		{Name: "first_name", Index: intPtr(1), Type: "string"},
+		{Name: "last_name", Index: intPtr(2), Type: "string"},
+		{Name: "email", Index: intPtr(3), Type: "string"},
+		{Name: "join_date", Index: intPtr(5), Type: "date"},
+	},
+}
+
+func loadSchema(path string) (*Schema, error) {
+	schemaBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading CSV schema file: %v", err)
+	}
+	var schema Schema
+	if err := json.Unmarshal(schemaBytes, &schema); err != nil {
+		return nil, fmt.Errorf("error parsing CSV schema file: %v", err)
+	}
+	if err := schema.validate(); err != nil {
+		return nil, fmt.Errorf("invalid CSV schema %s: %v", path, err)
+	}
+	return &schema, nil
+}
+
+func csvSchema() (*Schema, error) {
+	path := os.Getenv("CSV_SCHEMA")
+	if path == "" {
+		return &defaultSchema, nil
+	}
+	return loadSchema(path)
+}
+
+func (s *Schema) validate() error {
+	seen := map[string]bool{}
+	for i, column := range s.Columns {
+		if column.Name == "" {
+			return fmt.Errorf("column without a name")
+		}
+		if seen[column.Name] {
+			return fmt.Errorf("column %q declared twice", column.Name)
+		}
+		seen[column.Name] = true
+		if column.Name == membershipField {
+			return fmt.Errorf("column name %q is reserved for the computed membership status", column.Name)
+		}
+		if column.Name == "member_since" && column.Type != "date" {
+			return fmt.Errorf("column %q must have type date", column.Name)
+		}
+		if column.Index == nil && column.Header == "" {
+			return fmt.Errorf("column %q needs an index or a header", column.Name)
+		}
+		if column.Index != nil && *column.Index < 0 {
+			return fmt.Errorf("column %q has a negative index", column.Name)
+		}
+		if !columnTypes[column.Type] {
+			return fmt.Errorf("column %q has unknown type %q", column.Name, column.Type)
+		}
+		if column.Separator != "" && column.Type != "list" {
+			return fmt.Errorf("column %q has a separator but is not a list", column.Name)
+		}
+		if column.Decimal != "" && (column.Type != "number" || (column.Decimal != "." && column.Decimal != ",")) {
+			return fmt.Errorf("column %q decimal separator must be . or , on a number column", column.Name)
+		}
+		if len(column.Currency) > 0 && column.Type != "number" {
+			return fmt.Errorf("column %q has currencies but is not a number column", column.Name)
+		}
+		for j, step := range column.Normalize {
+			switch step.Step {
+			case "trim", "lower", "upper":
+			case "replace":
+				pattern, err := regexp.Compile(step.Pattern)
+				if err != nil {
+					return fmt.Errorf("column %q has an invalid replace pattern: %v", column.Name, err)
+				}
+				s.Columns[i].Normalize[j].pattern = pattern
+			default:
+				return fmt.Errorf("column %q has unknown normalize step %q", column.Name, step.Step)
+			}
+		}
+		if column.Type != "list" {
+			if _, err := column.parseValue(column.Default); err != nil {
+				return fmt.Errorf("column %q has an invalid default: %v", column.Name, err)
+			}
+		}
+	}
+	if !seen["join_date"] {
+		return fmt.Errorf("a join_date column is required")
+	}
+	return nil
+}
+
+// resolve returns the column index of every schema column, looking up
+// header-based columns in the CSV header row.
+func (s *Schema) resolve(header []string) (map[string]int, error) {
+	indexes := map[string]int{}
+	for _, column := range s.Columns {
+		if column.Index != nil {
+			indexes[column.Name] = *column.Index
+			continue
+		}
+		found := false
+		for i, name := range header {
+			if strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(column.Header)) {
+				indexes[column.Name] = i
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("header %q for column %q not found in CSV", column.Header, column.Name)
+		}
+	}
+	return indexes, nil
+}
+
+func (c Column) separator() string {
+	if c.Separator == "" {
+		return "|"
+	}
+	return c.Separator
+}
+
+// splitList returns the trimmed, non-empty parts of value. The result is
+// never nil, so an empty list column encodes as [] rather than null.
+func splitList(value, separator string) []string {
+	values := []string{}
+	for _, part := range strings.Split(value, separator) {
+		if part = strings.TrimSpace(part); part != "" {
+			values = append(values, part)
+		}
+	}
+	return values
+}
+
+// decimalSeparator is the decimal separator of a number column.
+func (c Column) decimalSeparator() (string, error) {
+	if c.Decimal != "" {
+		return c.Decimal, nil
+	}
+	switch separator := os.Getenv("NUMBER_DECIMAL_SEPARATOR"); separator {
+	case "":
+		return ".", nil
+	case ".", ",":
+		return separator, nil
+	default:
+		return "", fmt.Errorf("NUMBER_DECIMAL_SEPARATOR must be . or ,, got %q", separator)
+	}
+}
+
+var defaultCurrencies = []string{"€", "$", "£", "¥", "CHF", "EUR", "USD", "GBP"}
+
+// currencies are the symbols and codes stripped from a number column: the
+// column's Currency, else NUMBER_CURRENCIES (comma separated), else the
+// common euro, dollar, pound, yen and franc ones.
+func (c Column) currencies() []string {
+	if len(c.Currency) > 0 {
+		return c.Currency
+	}
+	if currencies := splitList(os.Getenv("NUMBER_CURRENCIES"), ","); len(currencies) > 0 {
+		return currencies
+	}
+	return defaultCurrencies
+}
+
+// groupSeparators are the thousands separators allowed next to a decimal
+// separator: the other punctuation mark, apostrophes and spaces.
+func groupSeparators(decimal string) string {
+	if decimal == "," {
+		return ".' \u00a0\u202f"
+	}
+	return ",' \u00a0\u202f"
+}
+
+// trimCurrency removes the longest currency symbol or code found at either
+// end of value, so "US$" wins over "$".
+func trimCurrency(value string, currencies []string) string {
+	trimmed, longest := value, 0
+	for _, currency := range currencies {
+		if len(currency) <= longest {
+			continue
+		}
+		if rest, found := strings.CutPrefix(value, currency); found {
+			trimmed, longest = rest, len(currency)
+		} else if rest, found := strings.CutSuffix(value, currency); found {
+			trimmed, longest = rest, len(currency)
+		}
+	}
+	return strings.TrimSpace(trimmed)
+}
+
+func isDigits(value string) bool {
+	for _, r := range value {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return value != ""
+}
+
+// parseNumber reads a formatted amount such as "£1,200.00", "1 200,50 €" or
+// "-CHF 1'200": the given currency symbols and codes go, thousands separators
+// must group three digits after a leading group of one to three, and the
+// result is a plain decimal number like "1200.00". Anything else is refused.
+func parseNumber(value, decimal string, currencies []string) (string, error) {
+	invalid := fmt.Errorf("expected a number, got %q", value)
+	cleaned := trimCurrency(strings.TrimSpace(value), currencies)
+	negative := strings.HasPrefix(cleaned, "-")
+	if negative {
+		cleaned = trimCurrency(strings.TrimSpace(cleaned[1:]), currencies)
+	}
+
+	integer, fraction, hasFraction := strings.Cut(cleaned, decimal)
+	if hasFraction && !isDigits(fraction) {
+		return "", invalid
+	}
+	separators := groupSeparators(decimal)
+	groups := strings.FieldsFunc(integer, func(r rune) bool { return strings.ContainsRune(separators, r) })
+	if len(groups) == 0 {
+		return "", invalid
+	}
+	for i, group := range groups {
+		if !isDigits(group) || (len(groups) > 1 && (i == 0 && len(group) > 3 || i > 0 && len(group) != 3)) {
+			return "", invalid
+		}
+	}
+	// Separators may only stand alone between groups, "1,,200" is refused.
+	if utf8.RuneCountInString(integer) != utf8.RuneCountInString(strings.Join(groups, "x")) {
+		return "", invalid
+	}
+
+	number := strings.Join(groups, "")
+	if hasFraction {
+		number += "." + fraction
+	}
+	if negative {
+		number = "-" + number
+	}
+	return number, nil
+}
+
+func (c Column) parseValue(value string) (string, error) {
+	if c.Type == "number" && value != "" {
+		decimal, err := c.decimalSeparator()
+		if err != nil {
+			return "", err
+		}
+		return parseNumber(value, decimal, c.currencies())
+	}
+	return parseColumnValue(c.Type, value)
+}
+
+func parseColumnValue(columnType, value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	switch columnType {
+	case "bool":
+		switch strings.ToLower(value) {
+		case "yes", "oui", "y":
+			return "true", nil
+		case "no", "non", "n":
+			return "false", nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("expected a boolean, got %q", value)
+		}
+		return strconv.FormatBool(b), nil
+	case "email":
+		address, err := mail.ParseAddress(value)
+		if err != nil {
+			return "", fmt.Errorf("expected an email address, got %q", value)
+		}
+		return address.Address, nil
+	case "phone":
+		digits := 0
+		for i, r := range value {
+			switch {
+			case r >= '0' && r <= '9':
+				digits++
+			case r == '+' && i == 0:
+			case strings.ContainsRune(" .-()", r):
+			default:
+				return "", fmt.Errorf("expected a phone number, got %q", value)
+			}
+		}
+		if digits < 6 {
+			return "", fmt.Errorf("expected a phone number, got %q", value)
+		}
+		return value, nil
+	case "date":
+		date, err := parseDate(value)
+		if err != nil {
+			return "", err
+		}
+		return date.Format("2006-01-02"), nil
+	}
+	return value, nil
+}
+
+// RowError describes why a CSV line couldn't be used, for the server logs and
+// the -validate report alike.
+type RowError struct {
+	Line   int    `json:"line"`
+	Field  string `json:"field,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (e *RowError) Error() string {
+	if e.Field == "" {
+		return fmt.Sprintf("Error parsing line %d: %s", e.Line, e.Reason)
+	}
+	return fmt.Sprintf("Error parsing line %d: column %q: %s", e.Line, e.Field, e.Reason)
+}
+
+// ParseResult holds what parseRoster got through. Truncated is set when the
+// parse deadline hit before the last row.
+type ParseResult struct {
+	Members   []Member
+	Errors    []RowError
+	Warnings  []RowError
+	Truncated bool
+}
+
+// parseRoster parses every data row, collecting row errors instead of
+// stopping at the first one. Rows are read one at a time and discarded once
+// parsed, so only the members are held in memory. The returned error is for
+// problems that affect the whole file, like a missing header or malformed
+// CSV, or for the context ending mid-parse, in which case the rows parsed so
+// far are still returned.
+func parseRoster(ctx context.Context, reader rowReader, schema *Schema) (ParseResult, error) {
+	result := ParseResult{}
+	header, err := reader.Read()
+	if err == io.EOF {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	indexes, err := schema.resolve(header)
+	if err != nil {
+		return result, err
+	}
+	minColumns := 0
+	for _, index := range indexes {
+		minColumns = max(minColumns, index+1)
+	}
+	strict, err := uniquenessStrict()
+	if err != nil {
+		return result, err
+	}
+	shared := sharedEmails()
+	if _, hasId := indexes["id"]; shared && !hasId {
+		return result, fmt.Errorf("CSV_SHARED_EMAILS needs an id column in the CSV schema, members can't be told apart by email")
+	}
+	term, err := loadMembershipTerm()
+	if err != nil {
+		return result, err
+	}
+	options := parseOptions{
+		term: term,
+		// Row errors end up in logs and error pages, so they don't quote
+		// redacted values in full.
+		redacted: redactedFields(),
+		names:    loadNameParts(),
+	}
+
+	var lines []int
+	for {
+		if err := ctx.Err(); err != nil {
+			result.Truncated = true
+			line, _ := reader.FieldPos(0)
+			return result, fmt.Errorf("CSV parse stopped after line %d: %v", line, err)
+		}
+		row, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return result, err
+		}
+		line, _ := reader.FieldPos(0)
+		if len(row) < minColumns {
+			result.Warnings = append(result.Warnings, RowError{
+				Line:   line,
+				Reason: fmt.Sprintf("skipped, %d columns instead of at least %d", len(row), minColumns),
+			})
+			continue
+		}
+		member, rowErr := schema.parseRow(row, indexes, options)
+		if rowErr != nil {
+			rowErr.Line = line
+			result.Errors = append(result.Errors, *rowErr)
+			continue
+		}
+		result.Members = append(result.Members, member)
+		lines = append(lines, line)
+	}
+	checkUniqueness(&result, lines, strict, shared)
+	return result, nil
+}
+
+// uniquenessStrict reads CSV_UNIQUENESS: "warn" (the default) keeps the first
+// member of a colliding ID or email, "strict" makes collisions blocking.
+func uniquenessStrict() (bool, error) {
+	switch mode := os.Getenv("CSV_UNIQUENESS"); mode {
+	case "", "warn":
+		return false, nil
+	case "strict":
+		return true, nil
+	default:
+		return false, fmt.Errorf("CSV_UNIQUENESS must be warn or strict, got %q", mode)
+	}
+}
+
+// sharedEmails reads CSV_SHARED_EMAILS: when "true", several members may share
+// one email, as family members do, and only IDs have to be unique.
+func sharedEmails() bool {
+	return os.Getenv("CSV_SHARED_EMAILS") == "true"
+}
+
+// checkUniqueness makes sure no two members share an ID or, unless emails are
+// shared, an email, since they would share one wallet object. The first line
+// in the file wins.
+func checkUniqueness(result *ParseResult, lines []int, strict, shared bool) {
+	ids := map[string]int{}
+	emails := map[string]int{}
+	var unique []Member
+	for i, member := range result.Members {
+		field, firstLine := "", 0
+		email := strings.ToLower(member.Email)
+		if line, seen := emails[email]; seen && email != "" && !shared {
+			field, firstLine = "email", line
+		} else if line, seen := ids[member.ID]; seen {
+			field, firstLine = "id", line
+		}
+		if field == "" {
+			ids[member.ID] = lines[i]
+			if email != "" {
+				emails[email] = lines[i]
+			}
+			unique = append(unique, member)
+			continue
+		}
+
+		collision := RowError{
+			Line:   lines[i],
+			Field:  field,
+			Reason: fmt.Sprintf("same %s as line %d", field, firstLine),
+		}
+		if strict {
+			result.Errors = append(result.Errors, collision)
+		} else {
+			collision.Reason += ", skipped"
+			result.Warnings = append(result.Warnings, collision)
+			log.Printf("Warning: line %d has the same %s as line %d, skipped", lines[i], field, firstLine)
+		}
+	}
+	result.Members = unique
+}
+
+// parseOptions is the configuration parseRow applies to each row.
+type parseOptions struct {
+	term     membershipTerm
+	redacted map[string]bool
+	names    *nameParts
+}
+
+// parseRow builds a Member from one CSV row. Columns without a dedicated
+// Member field are kept in Member.Extra, or Member.Lists for list columns,
+// under their logical name.
+func (s *Schema) parseRow(row []string, indexes map[string]int, options parseOptions) (Member, *RowError) {
+	member := Member{}
+	for _, column := range s.Columns {
+		raw := strings.TrimSpace(row[indexes[column.Name]])
+		for _, step := range column.Normalize {
+			raw = step.apply(raw)
+		}
+		if raw == "" {
+			raw = column.Default
+		}
+		if column.Type == "list" {
+			if member.Lists == nil {
+				member.Lists = map[string][]string{}
+			}
+			member.Lists[column.Name] = splitList(raw, column.separator())
+			continue
+		}
+		value, err := column.parseValue(raw)
+		if err != nil {
+			reason := err.Error()
+			if options.redacted[column.Name] {
+				reason = strings.ReplaceAll(reason, raw, maskValue(raw))
+			}
+			return Member{}, &RowError{Field: column.Name, Reason: reason}
+		}
+		switch column.Name {
+		case "id":
+			member.ID = value
+		case "first_name":
+			member.FirstName = value
+		case "last_name":
+			member.LastName = value
+		case "email":
+			member.Email = value
+		case "language":
+			member.Language = value
+		case "join_date":
+			joinDate, err := time.Parse("2006-01-02", value)
+			if err != nil {
+				return Member{}, &RowError{Field: column.Name, Reason: fmt.Sprintf("invalid join date %q", value)}
+			}
+			member.JoinDate = joinDate
+			member.ExpirationDate = options.term.expiration(joinDate)
+		case "member_since":
+			if value != "" {
+				memberSince, err := time.Parse("2006-01-02", value)
+				if err != nil {
+					return Member{}, &RowError{Field: column.Name, Reason: fmt.Sprintf("invalid member since date %q", value)}
+				}
+				member.MemberSince = memberSince
+			}
+		default:
+			if member.Extra == nil {
+				member.Extra = map[string]string{}
+			}
+			member.Extra[column.Name] = value
+		}
+	}
+	// join_date starts the current term; members who lapsed and rejoined
+	// keep their original join date in member_since.
+	if member.MemberSince.IsZero() {
+		member.MemberSince = member.JoinDate
+	}
+	options.names.apply(&member)
+	if member.ID == "" {
+		member.ID = deriveMemberId(member)
+	}
+	return member, nil
+}
+
+// deriveMemberId gives members a stable ID when the roster has no ID
+// column, based on their email or, failing that, their name and original
+// join date.
+func deriveMemberId(m Member) string {
+	key := strings.ToLower(m.Email)
+	if key == "" {
+		key = strings.ToLower(m.FirstName + "|" + m.LastName + "|" + m.MemberSince.Format("2006-01-02"))
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:6])
+}
@@ -0,0 +1,627 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readAllRows parses a CSV the way the roster was read before streaming:
+// csv.Reader.ReadAll first, then the rows. Lines are counted from 1 and the
+// test rosters have no multi-line cells.
+type readAllRows struct {
+	recordRows
+}
+
+func newReadAllRows(t testing.TB, content string) *readAllRows {
+	t.Helper()
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &readAllRows{recordRows{rows: records}}
+}
+
+func (r *readAllRows) FieldPos(field int) (line, column int) {
+	line, column = r.recordRows.FieldPos(field)
+	return line + 1, column
+}
+
+func streamRows(content string) rowReader {
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.ReuseRecord = true
+	reader.FieldsPerRecord = -1
+	return reader
+}
+
+const rosterHeader = "n,first_name,last_name,email,roles,join_date\n"
+
+func largeRoster(rows int) string {
+	var roster strings.Builder
+	roster.WriteString(rosterHeader)
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&roster, "%d,First%d,Last%d,member%d@example.org,,01/03/2026\n", i, i, i, i)
+	}
+	return roster.String()
+}
+
+func TestStreamingParseMatchesReadAll(t *testing.T) {
+	tests := []struct {
+		name   string
+		roster string
+	}{
+		{"empty", ""},
+		{"header only", rosterHeader},
+		{"valid rows", largeRoster(50)},
+		{"bad, short and duplicate rows", rosterHeader +
+			"1,Ada,Lovelace,ada@example.org,,01/03/2026\n" +
+			"2,Grace,Hopper,grace@example.org,,someday\n" +
+			"3,Alan\n" +
+			"4,Ada,Byron,ADA@example.org,,01/03/2026\n" +
+			"5,Edsger,Dijkstra,edsger@example.org,,01/03/2026\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			streamed, streamErr := parseRoster(context.Background(), streamRows(tt.roster), &defaultSchema)
+			readAll, readAllErr := parseRoster(context.Background(), newReadAllRows(t, tt.roster), &defaultSchema)
+			if (streamErr == nil) != (readAllErr == nil) {
+				t.Fatalf("streaming error %v, ReadAll error %v", streamErr, readAllErr)
+			}
+			if !reflect.DeepEqual(streamed, readAll) {
+				t.Errorf("streaming parse\n%+v\ndiffers from ReadAll parse\n%+v", streamed, readAll)
+			}
+		})
+	}
+}
+
+// The streaming parse only holds the members; the ReadAll parse holds every
+// raw row next to them. Compare with -benchmem.
+func BenchmarkParseRosterStreaming(b *testing.B) {
+	roster := largeRoster(20000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := parseRoster(context.Background(), streamRows(roster), &defaultSchema); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseRosterReadAll(b *testing.B) {
+	roster := largeRoster(20000)
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := parseRoster(context.Background(), newReadAllRows(b, roster), &defaultSchema); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParseNumber(t *testing.T) {
+	swiss := []string{"CHF", "Fr."}
+	tests := []struct {
+		value      string
+		decimal    string
+		currencies []string
+		want       string
+		wantErr    bool
+	}{
+		{value: "1200", decimal: ".", want: "1200"},
+		{value: "£1,200.00", decimal: ".", want: "1200.00"},
+		{value: "$ 1,234,567.5", decimal: ".", want: "1234567.5"},
+		{value: "USD 12", decimal: ".", want: "12"},
+		{value: "-£3.50", decimal: ".", want: "-3.50"},
+		{value: "- 3.50 €", decimal: ".", want: "-3.50"},
+		{value: "1 200,50 €", decimal: ",", want: "1200.50"},
+		{value: "1\u202f200,50\u00a0€", decimal: ",", want: "1200.50"},
+		{value: "1\u00a0200,50", decimal: ",", want: "1200.50"},
+		{value: "1.200,00", decimal: ",", want: "1200.00"},
+		{value: "EUR 0,5", decimal: ",", want: "0.5"},
+		{value: "CHF 1'200.00", decimal: ".", currencies: swiss, want: "1200.00"},
+		{value: "1'200 Fr.", decimal: ".", currencies: swiss, want: "1200"},
+		{value: "£12", decimal: ".", currencies: swiss, wantErr: true},
+		{value: "1e5", decimal: ".", wantErr: true},
+		{value: "v2", decimal: ".", wantErr: true},
+		{value: "abc1", decimal: ".", wantErr: true},
+		{value: "12 members", decimal: ".", wantErr: true},
+		{value: "1200,000", decimal: ".", wantErr: true},
+		{value: "12,34", decimal: ".", wantErr: true},
+		{value: "1,2,3", decimal: ".", wantErr: true},
+		{value: "1,,200", decimal: ".", wantErr: true},
+		{value: ",200", decimal: ".", wantErr: true},
+		{value: "1200.5", decimal: ",", wantErr: true},
+		{value: "12.", decimal: ".", wantErr: true},
+		{value: "1.2.3", decimal: ".", wantErr: true},
+		{value: "€", decimal: ",", wantErr: true},
+		{value: "--3", decimal: ".", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			currencies := tt.currencies
+			if currencies == nil {
+				currencies = defaultCurrencies
+			}
+			got, err := parseNumber(tt.value, tt.decimal, currencies)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseNumber(%q, %q) = %q, want an error", tt.value, tt.decimal, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("parseNumber(%q, %q) = %q, %v, want %q", tt.value, tt.decimal, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNumberColumnSettings(t *testing.T) {
+	t.Setenv("NUMBER_DECIMAL_SEPARATOR", ",")
+	t.Setenv("NUMBER_CURRENCIES", "kr, SEK")
+	column := Column{Name: "fee", Type: "number"}
+	if got, err := column.parseValue("1 200,50 kr"); err != nil || got != "1200.50" {
+		t.Errorf("with the program defaults, parseValue = %q, %v, want 1200.50", got, err)
+	}
+	column.Decimal, column.Currency = ".", []string{"$"}
+	if got, err := column.parseValue("$1,200.50"); err != nil || got != "1200.50" {
+		t.Errorf("with column settings, parseValue = %q, %v, want 1200.50", got, err)
+	}
+	if _, err := column.parseValue("1200 kr"); err == nil {
+		t.Error("a currency the column doesn't list was accepted")
+	}
+}
+
+func TestCheckUniqueness(t *testing.T) {
+	ada := Member{ID: "1", FirstName: "Ada", Email: "ada@example.org"}
+	adaUpper := Member{ID: "2", FirstName: "Ada", Email: "ADA@example.org"}
+	sameId := Member{ID: "1", FirstName: "Augusta", Email: "augusta@example.org"}
+	noEmail := Member{ID: "3", FirstName: "Noor"}
+	noEmailToo := Member{ID: "4", FirstName: "Nils"}
+
+	tests := []struct {
+		name         string
+		members      []Member
+		strict       bool
+		shared       bool
+		wantMembers  []Member
+		wantErrors   []RowError
+		wantWarnings []RowError
+	}{
+		{
+			name:        "unique",
+			members:     []Member{ada, noEmail, noEmailToo},
+			wantMembers: []Member{ada, noEmail, noEmailToo},
+		},
+		{
+			name:         "same email in another case is skipped",
+			members:      []Member{ada, adaUpper},
+			wantMembers:  []Member{ada},
+			wantWarnings: []RowError{{Line: 3, Field: "email", Reason: "same email as line 2, skipped"}},
+		},
+		{
+			name:         "same id is skipped",
+			members:      []Member{ada, sameId},
+			wantMembers:  []Member{ada},
+			wantWarnings: []RowError{{Line: 3, Field: "id", Reason: "same id as line 2, skipped"}},
+		},
+		{
+			name:        "strict collisions are errors",
+			members:     []Member{ada, adaUpper, sameId},
+			strict:      true,
+			wantMembers: []Member{ada},
+			wantErrors: []RowError{
+				{Line: 3, Field: "email", Reason: "same email as line 2"},
+				{Line: 4, Field: "id", Reason: "same id as line 2"},
+			},
+		},
+		{
+			name:         "shared emails only need unique ids",
+			members:      []Member{ada, adaUpper, sameId},
+			shared:       true,
+			wantMembers:  []Member{ada, adaUpper},
+			wantWarnings: []RowError{{Line: 4, Field: "id", Reason: "same id as line 2, skipped"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ParseResult{Members: tt.members}
+			lines := make([]int, len(tt.members))
+			for i := range lines {
+				lines[i] = i + 2
+			}
+			checkUniqueness(&result, lines, tt.strict, tt.shared)
+			if !reflect.DeepEqual(result.Members, tt.wantMembers) {
+				t.Errorf("members = %+v, want %+v", result.Members, tt.wantMembers)
+			}
+			if !reflect.DeepEqual(result.Errors, tt.wantErrors) {
+				t.Errorf("errors = %+v, want %+v", result.Errors, tt.wantErrors)
+			}
+			if !reflect.DeepEqual(result.Warnings, tt.wantWarnings) {
+				t.Errorf("warnings = %+v, want %+v", result.Warnings, tt.wantWarnings)
+			}
+		})
+	}
+}
+
+func TestSchemaMemberSinceIsADate(t *testing.T) {
+	joinDate := Column{Name: "join_date", Header: "join_date", Type: "date"}
+	tests := []struct {
+		kind    string
+		wantErr bool
+	}{
+		{"date", false},
+		{"string", true},
+		{"number", true},
+	}
+	for _, tt := range tests {
+		schema := &Schema{Columns: []Column{joinDate, {Name: "member_since", Header: "since", Type: tt.kind}}}
+		if err := schema.validate(); (err != nil) != tt.wantErr {
+			t.Errorf("member_since of type %s: validate() = %v, want error %v", tt.kind, err, tt.wantErr)
+		}
+	}
+}
+
+func parseWithSchema(t *testing.T, roster string) ParseResult {
+	t.Helper()
+	result, err := parseCSV(context.Background(), strings.NewReader(roster))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return result
+}
+
+// The shipped example schema locates columns by header, in any order, and
+// parses each one by its type.
+func TestSchemaFileDrivesParsing(t *testing.T) {
+	t.Setenv("CSV_SCHEMA", "schemas/headers.json")
+	result := parseWithSchema(t, "Rôles,Email,Nom,Prénom,Date d'adhésion,Téléphone,Newsletter,Cotisation\n"+
+		"board|volunteer,Jane@Example.com,Doe,Jane,01/03/2026,+33 6 01 02 03 04,oui,\"1 200,50 €\"\n")
+	if len(result.Errors) > 0 {
+		t.Fatalf("row errors: %+v", result.Errors)
+	}
+	want := Member{
+		ID:             deriveMemberId(Member{Email: "jane@example.com"}),
+		FirstName:      "Jane",
+		LastName:       "Doe",
+		Email:          "jane@example.com",
+		JoinDate:       date("2026-03-01"),
+		MemberSince:    date("2026-03-01"),
+		ExpirationDate: date("2027-03-01"),
+		Extra:          map[string]string{"phone": "06 01 02 03 04", "newsletter": "true", "fee": "1200.50"},
+		Lists:          map[string][]string{"roles": {"board", "volunteer"}},
+	}
+	if !reflect.DeepEqual(result.Members, []Member{want}) {
+		t.Errorf("parsed\n%+v\nwant\n%+v", result.Members, []Member{want})
+	}
+}
+
+func TestSchemaTypeMismatches(t *testing.T) {
+	t.Setenv("CSV_SCHEMA", "schemas/headers.json")
+	header := "Prénom,Nom,Email,Téléphone,Newsletter,Rôles,Cotisation,Date d'adhésion\n"
+	tests := []struct {
+		row   string
+		field string
+	}{
+		{"Jane,Doe,not an email,,,,,01/03/2026", "email"},
+		{"Jane,Doe,jane@example.com,call me,,,,01/03/2026", "phone"},
+		{"Jane,Doe,jane@example.com,,maybe,,,01/03/2026", "newsletter"},
+		{"Jane,Doe,jane@example.com,,,,douze,01/03/2026", "fee"},
+		{"Jane,Doe,jane@example.com,,,,,someday", "join_date"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			result := parseWithSchema(t, header+tt.row+"\n")
+			if len(result.Members) != 0 || len(result.Errors) != 1 {
+				t.Fatalf("parsed %+v with errors %+v, want one row error", result.Members, result.Errors)
+			}
+			if got := result.Errors[0]; got.Line != 2 || got.Field != tt.field {
+				t.Errorf("row error %+v, want line 2, column %s", got, tt.field)
+			}
+		})
+	}
+}
+
+func TestExampleSchemasAreValid(t *testing.T) {
+	for _, path := range []string{"schemas/headers.json", "schemas/google_form.json"} {
+		if _, err := loadSchema(path); err != nil {
+			t.Errorf("%s: %v", path, err)
+		}
+	}
+}
+
+func TestListColumns(t *testing.T) {
+	useSchema(t, `{"columns": [
+		{"name": "first_name", "header": "name", "type": "string"},
+		{"name": "roles", "header": "roles", "type": "list"},
+		{"name": "chapters", "header": "chapters", "type": "list", "separator": ","},
+		{"name": "join_date", "header": "joined", "type": "date"}
+	]}`)
+	tests := []struct {
+		roles        string
+		chapters     string
+		wantRoles    []string
+		wantChapters []string
+	}{
+		{`board|volunteer`, `"Paris,Nantes"`, []string{"board", "volunteer"}, []string{"Paris", "Nantes"}},
+		{` board | volunteer |`, `" Paris , Nantes "`, []string{"board", "volunteer"}, []string{"Paris", "Nantes"}},
+		{`board`, `Paris`, []string{"board"}, []string{"Paris"}},
+		{`"board,volunteer"`, `Paris|Nantes`, []string{"board,volunteer"}, []string{"Paris|Nantes"}},
+		{``, ``, []string{}, []string{}},
+		{`|`, `" , "`, []string{}, []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.roles, func(t *testing.T) {
+			result := parseWithSchema(t, "name,roles,chapters,joined\nJane,"+tt.roles+","+tt.chapters+",01/03/2026\n")
+			if len(result.Members) != 1 {
+				t.Fatalf("parsed %+v, errors %+v", result.Members, result.Errors)
+			}
+			lists := result.Members[0].Lists
+			if !reflect.DeepEqual(lists["roles"], tt.wantRoles) || !reflect.DeepEqual(lists["chapters"], tt.wantChapters) {
+				t.Errorf("lists = %q, want roles %q and chapters %q", lists, tt.wantRoles, tt.wantChapters)
+			}
+		})
+	}
+}
+
+// Empty list columns encode as [] rather than null.
+func TestEmptyListEncoding(t *testing.T) {
+	encoded, err := json.Marshal(Member{Lists: map[string][]string{"roles": splitList("", "|")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(encoded), `"roles":[]`) {
+		t.Errorf("empty list encoded as %s", encoded)
+	}
+}
+
+// lineReader hands out one CSV line per Read, calling onLine with the number
+// of lines read so far.
+type lineReader struct {
+	lines  []string
+	read   int
+	onLine func(read int)
+}
+
+func (r *lineReader) Read(p []byte) (int, error) {
+	if r.read == len(r.lines) {
+		return 0, io.EOF
+	}
+	n := copy(p, r.lines[r.read])
+	r.read++
+	r.onLine(r.read)
+	return n, nil
+}
+
+func TestParseDeadlineKeepsParsedRows(t *testing.T) {
+	t.Setenv("CSV_SCHEMA", "")
+	lines := []string{"id,first_name,last_name,email,status,join_date\n"}
+	for i := 1; i <= 10; i++ {
+		lines = append(lines, fmt.Sprintf("a%d,Jane,Doe,jane%d@example.com,paid,01/03/2026\n", i, i))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// The deadline hits once the header and three rows are read.
+	reader := &lineReader{lines: lines, onLine: func(read int) {
+		if read == 4 {
+			cancel()
+		}
+	}}
+
+	result, err := parseCSV(ctx, reader)
+	if err == nil || !strings.Contains(err.Error(), "CSV parse stopped after line 4") {
+		t.Errorf("parseCSV() error %v, want the parse stopped after line 4", err)
+	}
+	if !result.Truncated || len(result.Members) != 3 {
+		t.Errorf("parseCSV() = %d members, truncated %v, want the first 3 and truncated", len(result.Members), result.Truncated)
+	}
+}
+
+// readCSVFromUrl leaves partial rosters out: a source slower than
+// CSV_PARSE_TIMEOUT fails instead of hanging.
+func TestReadCsvFromUrlParseTimeout(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "id,first_name,last_name,email,status,join_date\n")
+		for i := 1; i <= 50; i++ {
+			fmt.Fprintf(w, "a%d,Jane,Doe,jane%d@example.com,paid,01/03/2026\n", i, i)
+			w.(http.Flusher).Flush()
+			select {
+			case <-r.Context().Done():
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}))
+	defer server.Close()
+	t.Setenv("CSV_SCHEMA", "")
+	t.Setenv("CSV_PARSE_TIMEOUT", "50ms")
+
+	start := time.Now()
+	members, err := readCSVFromUrl(server.URL)
+	if err == nil || !strings.Contains(err.Error(), "CSV parse stopped") || members != nil {
+		t.Errorf("readCSVFromUrl() = %d members, %v, want no members and the parse stopped", len(members), err)
+	}
+	if elapsed := time.Since(start); elapsed > 400*time.Millisecond {
+		t.Errorf("readCSVFromUrl() took %s, want it stopped near CSV_PARSE_TIMEOUT", elapsed)
+	}
+}
+
+func TestSchemaDefaults(t *testing.T) {
+	useSchema(t, `{"columns": [
+		{"name": "first_name", "header": "name", "type": "string"},
+		{"name": "status", "header": "status", "type": "string", "default": "paid"},
+		{"name": "language", "header": "language", "type": "string", "default": "en"},
+		{"name": "roles", "header": "roles", "type": "list", "default": "member"},
+		{"name": "fee", "header": "fee", "type": "number", "default": "30"},
+		{"name": "chapter", "header": "chapter", "type": "string", "default": "Nantes", "normalize": [{"step": "replace", "pattern": "^n/a$", "with": ""}]},
+		{"name": "join_date", "header": "joined", "type": "date", "default": "01/01/2026"}
+	]}`)
+	result := parseWithSchema(t, "name,status,language,roles,fee,chapter,joined\n"+
+		"Jane,,,,,,\n"+
+		"John,due,fr,board|volunteer,12.5,Paris,01/03/2026\n"+
+		"Ann,  ,  , , ,n/a,\n")
+	if len(result.Errors) > 0 || len(result.Members) != 3 {
+		t.Fatalf("parsed %+v, errors %+v", result.Members, result.Errors)
+	}
+	tests := []struct {
+		status, language, fee, chapter, joined string
+		roles                                  []string
+	}{
+		{"paid", "en", "30", "Nantes", "2026-01-01", []string{"member"}},
+		{"due", "fr", "12.5", "Paris", "2026-03-01", []string{"board", "volunteer"}},
+		{"paid", "en", "30", "Nantes", "2026-01-01", []string{"member"}},
+	}
+	for i, want := range tests {
+		m := result.Members[i]
+		got := []string{m.Extra["status"], m.Language, m.Extra["fee"], m.Extra["chapter"], m.JoinDate.Format("2006-01-02")}
+		if !reflect.DeepEqual(got, []string{want.status, want.language, want.fee, want.chapter, want.joined}) || !reflect.DeepEqual(m.Lists["roles"], want.roles) {
+			t.Errorf("%s: got %q and roles %q, want %+v", m.FirstName, got, m.Lists["roles"], want)
+		}
+	}
+}
+
+func TestSchemaRejectsInvalidDefaults(t *testing.T) {
+	for _, column := range []string{
+		`{"name": "fee", "header": "fee", "type": "number", "default": "thirty"}`,
+		`{"name": "newsletter", "header": "newsletter", "type": "bool", "default": "maybe"}`,
+		`{"name": "renewed", "header": "renewed", "type": "date", "default": "2026-13-45"}`,
+	} {
+		schema := Schema{}
+		if err := json.Unmarshal([]byte(`{"columns": [`+column+`, {"name": "join_date", "header": "joined", "type": "date"}]}`), &schema); err != nil {
+			t.Fatal(err)
+		}
+		if err := schema.validate(); err == nil || !strings.Contains(err.Error(), "invalid default") {
+			t.Errorf("%s: validate() = %v, want an invalid default", column, err)
+		}
+	}
+}
+
+// Family members sharing an email are all kept when CSV_SHARED_EMAILS is on,
+// told apart by their id column.
+func TestSharedEmailsKeepFamilies(t *testing.T) {
+	const family = "id,first_name,last_name,email,status,join_date\n" +
+		"f1,Jane,Doe,doe@example.com,paid,01/03/2026\n" +
+		"f2,John,Doe,DOE@example.com,paid,01/03/2026\n" +
+		"f3,Ann,Doe,doe@example.com,paid,01/03/2026\n"
+	useSchema(t, apiSchema)
+	tests := []struct {
+		shared     string
+		uniqueness string
+		wantIds    []string
+		wantErrors int
+	}{
+		{"true", "", []string{"f1", "f2", "f3"}, 0},
+		{"true", "strict", []string{"f1", "f2", "f3"}, 0},
+		{"", "", []string{"f1"}, 0},
+		{"", "strict", []string{"f1"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.shared+"/"+tt.uniqueness, func(t *testing.T) {
+			t.Setenv("CSV_SHARED_EMAILS", tt.shared)
+			t.Setenv("CSV_UNIQUENESS", tt.uniqueness)
+			result := parseWithSchema(t, family)
+			var ids []string
+			for _, m := range result.Members {
+				ids = append(ids, m.ID)
+			}
+			if !reflect.DeepEqual(ids, tt.wantIds) || len(result.Errors) != tt.wantErrors {
+				t.Errorf("kept %v with %d errors, want %v with %d", ids, len(result.Errors), tt.wantIds, tt.wantErrors)
+			}
+		})
+	}
+}
+
+func TestSharedEmailsNeedAnIdColumn(t *testing.T) {
+	t.Setenv("CSV_SCHEMA", "")
+	t.Setenv("CSV_SHARED_EMAILS", "true")
+	_, err := parseCSV(context.Background(), strings.NewReader("Timestamp,First,Last,Email\n"))
+	if err == nil || !strings.Contains(err.Error(), "needs an id column") {
+		t.Errorf("parseCSV() error %v, want an id column required", err)
+	}
+}
+
+func TestNormalizerChain(t *testing.T) {
+	chain := []Normalizer{{Step: "trim"}, {Step: "upper"}, {Step: "replace", Pattern: `^MB-?`}, {Step: "replace", Pattern: `^0+(\d)`, With: "$1"}}
+	schema := Schema{Columns: []Column{
+		{Name: "member_no", Header: "member_no", Type: "string", Normalize: chain},
+		{Name: "join_date", Header: "join_date", Type: "date"},
+	}}
+	if err := schema.validate(); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{" mb-00123 ", "123"},
+		{"MB0042", "42"},
+		{"mb-0", "0"},
+		{"x-17", "X-17"},
+		{"123", "123"},
+	}
+	for _, tt := range tests {
+		value := tt.value
+		for _, step := range schema.Columns[0].Normalize {
+			value = step.apply(value)
+		}
+		if value != tt.want {
+			t.Errorf("normalizing %q gave %q, want %q", tt.value, value, tt.want)
+		}
+	}
+
+	// The steps run in order: lowercasing after the replace leaves the
+	// prefix in place.
+	reordered := []Normalizer{{Step: "replace", Pattern: `^MB-?`}, {Step: "lower"}}
+	schema.Columns[0].Normalize = reordered
+	if err := schema.validate(); err != nil {
+		t.Fatal(err)
+	}
+	value := "mb-7"
+	for _, step := range schema.Columns[0].Normalize {
+		value = step.apply(value)
+	}
+	if value != "mb-7" {
+		t.Errorf("reordered steps gave %q, want mb-7", value)
+	}
+}
+
+// Normalizers run on the roster cells before they are typed.
+func TestNormalizersApplyWhileParsing(t *testing.T) {
+	useSchema(t, `{"columns": [
+		{"name": "first_name", "header": "name", "type": "string", "normalize": [{"step": "trim"}, {"step": "lower"}]},
+		{"name": "member_no", "header": "member_no", "type": "string", "normalize": [{"step": "upper"}, {"step": "replace", "pattern": "^MB-", "with": ""}]},
+		{"name": "phone", "header": "phone", "type": "string", "normalize": [{"step": "replace", "pattern": "^\\+33 ?", "with": "0"}, {"step": "replace", "pattern": "[ .]", "with": ""}]},
+		{"name": "join_date", "header": "joined", "type": "date"}
+	]}`)
+	result := parseWithSchema(t, "name,member_no,phone,joined\n  JANE ,mb-123,+33 6 01.02.03.04,01/03/2026\n")
+	if len(result.Members) != 1 {
+		t.Fatalf("parsed %+v, errors %+v", result.Members, result.Errors)
+	}
+	m := result.Members[0]
+	if m.FirstName != "jane" || m.Extra["member_no"] != "123" || m.Extra["phone"] != "0601020304" {
+		t.Errorf("parsed %q, %q, %q, want jane, 123, 0601020304", m.FirstName, m.Extra["member_no"], m.Extra["phone"])
+	}
+}
+
+func TestNormalizerValidation(t *testing.T) {
+	for _, step := range []Normalizer{{Step: "titlecase"}, {Step: "replace", Pattern: "(unclosed"}} {
+		schema := Schema{Columns: []Column{
+			{Name: "member_no", Header: "member_no", Type: "string", Normalize: []Normalizer{step}},
+			{Name: "join_date", Header: "join_date", Type: "date"},
+		}}
+		if err := schema.validate(); err == nil {
+			t.Errorf("normalize step %+v was accepted", step)
+		}
+	}
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RosterSource is where the roster comes from. Every source goes through the
+// CSV schema, so column types, defaults and uniqueness checks apply alike.
+type RosterSource interface {
+	Members() ([]Member, error)
+}
+
+// rosterSource reads ROSTER_SOURCE: "csv" (the default) reads CSV_URL,
+// "json_api" walks the paginated API at JSON_API_URL and "sse" follows the
+// event stream at SSE_URL.
+func rosterSource() (RosterSource, error) {
+	switch kind := os.Getenv("ROSTER_SOURCE"); kind {
+	case "", "csv":
+		url := os.Getenv("CSV_URL")
+		if url == "" {
+			return nil, fmt.Errorf("CSV_URL environment variable is not set")
+		}
+		return csvSource{url: url}, nil
+	case "json_api":
+		return loadJsonApiSource()
+	case "sse":
+		return loadSseSource()
+	default:
+		return nil, fmt.Errorf("ROSTER_SOURCE must be csv, json_api or sse, got %q", kind)
+	}
+}
+
+type csvSource struct {
+	url string
+}
+
+func (s csvSource) Members() ([]Member, error) {
+	return readCSVFromUrl(s.url)
+}
+
+// rowReader is what parseRoster reads rows from: a csv.Reader, or records
+// laid out as rows.
+type rowReader interface {
+	Read() ([]string, error)
+	FieldPos(field int) (line, column int)
+}
+
+// jsonApiSource pages through a REST API returning member records as JSON
+// objects. The schema columns name record keys through their header, or
+// their name when they have none; "address.city" reaches into nested
+// objects.
+//
+// Records are read from the JSON_API_RECORDS key of each page (default
+// "data"), or from the page itself when it is an array. The next page is the
+// JSON_API_NEXT link of the page (default "next"), the Link rel="next"
+// header, or, when JSON_API_PAGE_PARAM is set, the same URL with that query
+// parameter counting up from 1 until a page comes back empty.
+// JSON_API_AUTH_HEADER, e.g. "Authorization: Bearer ...", is sent with each
+// request.
+type jsonApiSource struct {
+	url        string
+	recordsKey string
+	nextKey    string
+	pageParam  string
+	authName   string
+	authValue  string
+}
+
+const (
+	jsonApiMaxPages   = 1000
+	jsonApiMaxRetries = 3
+)
+
+func loadJsonApiSource() (jsonApiSource, error) {
+	source := jsonApiSource{
+		url:        os.Getenv("JSON_API_URL"),
+		recordsKey: os.Getenv("JSON_API_RECORDS"),
+		nextKey:    os.Getenv("JSON_API_NEXT"),
+		pageParam:  os.Getenv("JSON_API_PAGE_PARAM"),
+	}
+	if source.url == "" {
+		return jsonApiSource{}, fmt.Errorf("JSON_API_URL environment variable is not set")
+	}
+	if source.recordsKey == "" {
+		source.recordsKey = "data"
+	}
+	if source.nextKey == "" {
+		source.nextKey = "next"
+	}
+	var err error
+	if source.authName, source.authValue, err = authHeaderFromEnv("JSON_API_AUTH_HEADER"); err != nil {
+		return jsonApiSource{}, err
+	}
+	return source, nil
+}
+
+// authHeaderFromEnv splits a "Name: value" header read from the environment.
+// name is empty when the variable is not set.
+func authHeaderFromEnv(variable string) (name, value string, err error) {
+	header := os.Getenv(variable)
+	if header == "" {
+		return "", "", nil
+	}
+	name, value, found := strings.Cut(header, ":")
+	if !found {
+		return "", "", fmt.Errorf("%s must look like Name: value", variable)
+	}
+	return strings.TrimSpace(name), strings.TrimSpace(value), nil
+}
+
+// get fetches one page, waiting out 429 responses as told by Retry-After.
+// Waits longer than the client timeout fail the fetch instead.
+func (s jsonApiSource) get(client *http.Client, pageUrl string) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, pageUrl, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		if s.authName != "" {
+			req.Header.Set(s.authName, s.authValue)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusTooManyRequests || attempt == jsonApiMaxRetries {
+			return nil, fmt.Errorf("error fetching %s: %s", pageUrl, resp.Status)
+		}
+		wait := time.Second << attempt
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+			wait = time.Duration(seconds) * time.Second
+		}
+		if client.Timeout > 0 && wait > client.Timeout {
+			return nil, fmt.Errorf("error fetching %s: rate limited for %s, longer than JSON_API_TIMEOUT", pageUrl, wait)
+		}
+		log.Printf("Roster API rate limited, retrying in %s", wait)
+		time.Sleep(wait)
+	}
+}
+
+// lookupPath follows a dot separated path through nested JSON objects.
+func lookupPath(value any, path string) (any, bool) {
+	for _, key := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = object[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+func nextLinkHeader(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		target, params, _ := strings.Cut(link, ";")
+		if strings.Contains(strings.ReplaceAll(params, " ", ""), `rel="next"`) {
+			return strings.Trim(strings.TrimSpace(target), "<>")
+		}
+	}
+	return ""
+}
+
+// page fetches one page and returns its records and the next page's URL,
+// empty on the last page.
+func (s jsonApiSource) page(client *http.Client, pageUrl string, number int) ([]any, string, error) {
+	resp, err := s.get(client, pageUrl)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	decoder.UseNumber()
+	var body any
+	if err := decoder.Decode(&body); err != nil {
+		return nil, "", fmt.Errorf("error parsing %s: %v", pageUrl, err)
+	}
+
+	records, ok := body.([]any)
+	if !ok {
+		value, _ := lookupPath(body, s.recordsKey)
+		if records, ok = value.([]any); !ok {
+			return nil, "", fmt.Errorf("page %s has no %q array of records", pageUrl, s.recordsKey)
+		}
+	}
+
+	if s.pageParam != "" {
+		if len(records) == 0 {
+			return records, "", nil
+		}
+		next, err := url.Parse(pageUrl)
+		if err != nil {
+			return nil, "", err
+		}
+		query := next.Query()
+		query.Set(s.pageParam, strconv.Itoa(number+1))
+		next.RawQuery = query.Encode()
+		return records, next.String(), nil
+	}
+	next, _ := lookupPath(body, s.nextKey)
+	nextUrl, _ := next.(string)
+	if nextUrl == "" {
+		nextUrl = nextLinkHeader(resp.Header.Get("Link"))
+	}
+	if nextUrl != "" {
+		base, err := url.Parse(pageUrl)
+		if err != nil {
+			return nil, "", err
+		}
+		resolved, err := base.Parse(nextUrl)
+		if err != nil {
+			return nil, "", fmt.Errorf("page %s has an invalid next link %q", pageUrl, nextUrl)
+		}
+		nextUrl = resolved.String()
+	}
+	return records, nextUrl, nil
+}
+
+func (s jsonApiSource) Members() ([]Member, error) {
+	client, err := outboundClient("JSON_API_TIMEOUT", 60*time.Second)
+	if err != nil {
+		return nil, err
+	}
+
+	pageUrl := s.url
+	if s.pageParam != "" {
+		first, err := url.Parse(pageUrl)
+		if err != nil {
+			return nil, err
+		}
+		query := first.Query()
+		query.Set(s.pageParam, "1")
+		first.RawQuery = query.Encode()
+		pageUrl = first.String()
+	}
+	var records []any
+	for number := 1; pageUrl != ""; number++ {
+		if number > jsonApiMaxPages {
+			return nil, fmt.Errorf("roster API has more than %d pages", jsonApiMaxPages)
+		}
+		page, next, err := s.page(client, pageUrl, number)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, page...)
+		pageUrl = next
+	}
+
+	schema, err := csvSchema()
+	if err != nil {
+		return nil, err
+	}
+	recordSchema, rows := jsonRecordRows(schema, records)
+	result, err := parseRoster(context.Background(), rows, recordSchema)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Errors) > 0 {
+		return nil, &result.Errors[0]
+	}
+	return result.Members, nil
+}
+
+// jsonRecordRows lays records out as rows in schema order, after a header row
+// of record keys, with a schema locating every column by that key.
+func jsonRecordRows(schema *Schema, records []any) (*Schema, *recordRows) {
+	recordSchema := &Schema{}
+	var keys []string
+	for _, column := range schema.Columns {
+		key := column.Header
+		if key == "" {
+			key = column.Name
+		}
+		column.Index = nil
+		column.Header = key
+		recordSchema.Columns = append(recordSchema.Columns, column)
+		keys = append(keys, key)
+	}
+	rows := &recordRows{rows: [][]string{keys}}
+	for _, record := range records {
+		row := make([]string, len(keys))
+		for i, key := range keys {
+			value, _ := lookupPath(record, key)
+			row[i] = jsonCellValue(value, recordSchema.Columns[i].separator())
+		}
+		rows.rows = append(rows.rows, row)
+	}
+	return recordSchema, rows
+}
+
+func jsonCellValue(value any, separator string) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []any:
+		var parts []string
+		for _, item := range v {
+			parts = append(parts, jsonCellValue(item, separator))
+		}
+		return strings.Join(parts, separator)
+	case json.Number, bool:
+		return fmt.Sprint(v)
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
+
+// recordRows serves rows to parseRoster; the line of a row is its record
+// number, the header being line 0.
+type recordRows struct {
+	rows [][]string
+	next int
+}
+
+func (r *recordRows) Read() ([]string, error) {
+	if r.next >= len(r.rows) {
+		return nil, io.EOF
+	}
+	r.next++
+	return r.rows[r.next-1], nil
+}
+
+func (r *recordRows) FieldPos(field int) (line, column int) {
+	return r.next - 1, field + 1
+}
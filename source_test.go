@@ -0,0 +1,159 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestJsonApiRetryAfter(t *testing.T) {
+	tests := []struct {
+		name       string
+		retryAfter string
+		wantErr    bool
+	}{
+		{"retried", "0", false},
+		{"wait past the timeout", "3600", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requests := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests == 1 {
+					w.Header().Set("Retry-After", tt.retryAfter)
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				w.Write([]byte(`{"data": []}`))
+			}))
+			defer server.Close()
+
+			start := time.Now()
+			resp, err := jsonApiSource{}.get(&http.Client{Timeout: time.Second}, server.URL)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "rate limited") {
+					t.Errorf("get() error %v, want the fetch to fail on the rate limit", err)
+				}
+				if elapsed := time.Since(start); elapsed > time.Second {
+					t.Errorf("get() waited %s before failing", elapsed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if requests != 2 {
+				t.Errorf("server got %d requests, want 2", requests)
+			}
+		})
+	}
+}
+
+// paginatedApi serves three records two per page, by next link, Link header
+// or page parameter, to requests carrying the API key.
+func paginatedApi(t *testing.T) *httptest.Server {
+	t.Helper()
+	records := []string{
+		`{"id": "a1", "name": {"first": "Jane", "last": "Doe"}, "email": "jane@example.com", "roles": ["board", "volunteer"], "fee": 30, "joined": "2026-03-01"}`,
+		`{"id": "a2", "name": {"first": "John", "last": "Roe"}, "email": "john@example.com", "roles": [], "fee": 12.5, "joined": "2026-03-02"}`,
+		`{"id": "a3", "name": {"first": "Ann", "last": "Poe"}, "email": "ann@example.com", "fee": null, "joined": "2026-03-03"}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Api-Key") != "s3cret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		page, err := strconv.Atoi(r.URL.Query().Get("page"))
+		if err != nil {
+			page = 1
+		}
+		start, end := min(2*(page-1), len(records)), min(2*page, len(records))
+		chunk := "[" + strings.Join(records[start:end], ",") + "]"
+		more := end < len(records)
+		switch r.URL.Path {
+		case "/links":
+			next := `null`
+			if more {
+				next = fmt.Sprintf(`"/links?page=%d"`, page+1)
+			}
+			fmt.Fprintf(w, `{"results": %s, "paging": {"next": %s}}`, chunk, next)
+		case "/headers":
+			if more {
+				w.Header().Set("Link", fmt.Sprintf(`<%s/headers?page=%d>; rel="next"`, "http://"+r.Host, page+1))
+			}
+			fmt.Fprint(w, chunk)
+		case "/pages":
+			fmt.Fprintf(w, `{"data": %s}`, chunk)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestJsonApiSourcePages(t *testing.T) {
+	server := paginatedApi(t)
+	useSchema(t, `{"columns": [
+		{"name": "id", "header": "id", "type": "string"},
+		{"name": "first_name", "header": "name.first", "type": "string"},
+		{"name": "last_name", "header": "name.last", "type": "string"},
+		{"name": "email", "header": "email", "type": "email"},
+		{"name": "roles", "header": "roles", "type": "list"},
+		{"name": "fee", "header": "fee", "type": "number", "default": "0"},
+		{"name": "join_date", "header": "joined", "type": "date"}
+	]}`)
+	t.Setenv("ROSTER_SOURCE", "json_api")
+	t.Setenv("JSON_API_AUTH_HEADER", "X-Api-Key: s3cret")
+
+	tests := []struct {
+		name, path, records, next, pageParam string
+	}{
+		{"next links", "/links", "results", "paging.next", ""},
+		{"Link header", "/headers", "", "", ""},
+		{"page parameter", "/pages", "", "", "page"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("JSON_API_URL", server.URL+tt.path)
+			t.Setenv("JSON_API_RECORDS", tt.records)
+			t.Setenv("JSON_API_NEXT", tt.next)
+			t.Setenv("JSON_API_PAGE_PARAM", tt.pageParam)
+			source, err := rosterSource()
+			if err != nil {
+				t.Fatal(err)
+			}
+			members, err := source.Members()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, m := range members {
+				got = append(got, fmt.Sprintf("%s %s %s %s %v %s %s", m.ID, m.FirstName, m.LastName, m.Email, m.Lists["roles"], m.Extra["fee"], m.JoinDate.Format("2006-01-02")))
+			}
+			want := []string{
+				"a1 Jane Doe jane@example.com [board volunteer] 30 2026-03-01",
+				"a2 John Roe john@example.com [] 12.5 2026-03-02",
+				"a3 Ann Poe ann@example.com [] 0 2026-03-03",
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("members\n%q\nwant\n%q", got, want)
+			}
+		})
+	}
+
+	t.Setenv("JSON_API_URL", server.URL+"/pages")
+	t.Setenv("JSON_API_AUTH_HEADER", "")
+	source, err := rosterSource()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := source.Members(); err == nil || !strings.Contains(err.Error(), "401") {
+		t.Errorf("Members() without the API key: %v, want the 401", err)
+	}
+}
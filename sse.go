@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sseSource keeps the roster up to date from a Server-Sent Events stream at
+// SSE_URL. Each event is an "add", "update" or "remove" carrying one member
+// record as JSON, laid out as for the JSON API source. Members are matched
+// on Member.ID: when the schema has an id column a remove only needs that
+// column, otherwise IDs are derived from the email or name, and a remove
+// carries the whole record like an add. On every connection the roster
+// starts over from the CSV at CSV_URL when one is set, and while the stream
+// is down that CSV is served instead.
+type sseSource struct {
+	url    string
+	csvUrl string
+}
+
+const sseMaxBackoff = time.Minute
+
+// sseClient waits SSE_CONNECT_TIMEOUT (default 10s) to connect and for the
+// response headers, but not for the body, which stays open as long as the
+// stream does.
+func sseClient() (*http.Client, error) {
+	timeout, err := durationFromEnv("SSE_CONNECT_TIMEOUT", 10*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: timeout, KeepAlive: 30 * time.Second}).DialContext
+	transport.TLSHandshakeTimeout = timeout
+	transport.ResponseHeaderTimeout = timeout
+	return &http.Client{Transport: transport}, nil
+}
+
+// liveRoster is the roster built from the stream, shared by every request.
+var liveRoster struct {
+	sync.Mutex
+	start     sync.Once
+	connected bool
+	order     []string
+	members   map[string]Member
+}
+
+func loadSseSource() (sseSource, error) {
+	source := sseSource{url: os.Getenv("SSE_URL"), csvUrl: os.Getenv("CSV_URL")}
+	if source.url == "" {
+		return sseSource{}, fmt.Errorf("SSE_URL environment variable is not set")
+	}
+	return source, nil
+}
+
+func (s sseSource) Members() ([]Member, error) {
+	liveRoster.start.Do(func() { go s.follow() })
+	liveRoster.Lock()
+	if liveRoster.connected {
+		members := make([]Member, 0, len(liveRoster.order))
+		for _, id := range liveRoster.order {
+			members = append(members, liveRoster.members[id])
+		}
+		liveRoster.Unlock()
+		return members, nil
+	}
+	liveRoster.Unlock()
+	if s.csvUrl == "" {
+		return nil, fmt.Errorf("roster stream %s is not connected", s.url)
+	}
+	return readCSVFromUrl(s.csvUrl)
+}
+
+// follow keeps a connection to the stream open, reconnecting with an
+// exponential backoff.
+func (s sseSource) follow() {
+	backoff := time.Second
+	for {
+		start := time.Now()
+		err := s.stream()
+		liveRoster.Lock()
+		liveRoster.connected = false
+		liveRoster.Unlock()
+		if time.Since(start) > sseMaxBackoff {
+			backoff = time.Second
+		}
+		log.Printf("Roster stream disconnected, reconnecting in %s: %v", backoff, err)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, sseMaxBackoff)
+	}
+}
+
+func (s sseSource) stream() error {
+	req, err := http.NewRequest(http.MethodGet, s.url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	client, err := sseClient()
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("error connecting to roster stream: %s", resp.Status)
+	}
+
+	var members []Member
+	if s.csvUrl != "" {
+		if members, err = readCSVFromUrl(s.csvUrl); err != nil {
+			return fmt.Errorf("error loading the roster the stream applies to: %v", err)
+		}
+	}
+	liveRoster.Lock()
+	liveRoster.order = nil
+	liveRoster.members = map[string]Member{}
+	for _, member := range members {
+		liveRoster.order = append(liveRoster.order, member.ID)
+		liveRoster.members[member.ID] = member
+	}
+	liveRoster.connected = true
+	liveRoster.Unlock()
+	log.Printf("Connected to roster stream %s", s.url)
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64<<10), 1<<20)
+	event, data := "", []string{}
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if err := applyRosterEvent(event, strings.Join(data, "\n")); err != nil {
+					log.Printf("Warning: roster stream %s event ignored: %v", event, err)
+				}
+			}
+			event, data = "", data[:0]
+		case strings.HasPrefix(line, ":"):
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("roster stream closed")
+}
+
+// parseRecord turns a stream record into a member through the schema.
+func parseRecord(schema *Schema, record any) (Member, error) {
+	recordSchema, rows := jsonRecordRows(schema, []any{record})
+	result, err := parseRoster(context.Background(), rows, recordSchema)
+	if err != nil {
+		return Member{}, err
+	}
+	if len(result.Errors) > 0 {
+		return Member{}, &result.Errors[0]
+	}
+	return result.Members[0], nil
+}
+
+func applyRosterEvent(event, data string) error {
+	if event != "add" && event != "update" && event != "remove" {
+		return fmt.Errorf("unknown event type")
+	}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(data)))
+	decoder.UseNumber()
+	var record map[string]any
+	if err := decoder.Decode(&record); err != nil {
+		return fmt.Errorf("invalid JSON: %v", err)
+	}
+
+	schema, err := csvSchema()
+	if err != nil {
+		return err
+	}
+	if event == "remove" {
+		for _, column := range schema.Columns {
+			if column.Name == "id" {
+				schema = &Schema{Columns: []Column{column}}
+				break
+			}
+		}
+	}
+	member, err := parseRecord(schema, record)
+	if err != nil {
+		return err
+	}
+
+	liveRoster.Lock()
+	defer liveRoster.Unlock()
+	_, exists := liveRoster.members[member.ID]
+	switch event {
+	case "add", "update":
+		if !exists {
+			liveRoster.order = append(liveRoster.order, member.ID)
+		}
+		liveRoster.members[member.ID] = member
+	case "remove":
+		if !exists {
+			return fmt.Errorf("no member %s", member.ID)
+		}
+		delete(liveRoster.members, member.ID)
+		for i, id := range liveRoster.order {
+			if id == member.ID {
+				liveRoster.order = append(liveRoster.order[:i], liveRoster.order[i+1:]...)
+				break
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// serveRosterStream serves the events, then keeps the stream open until the
+// test ends. The stream applies to the roster at CSV_URL.
+func serveRosterStream(t *testing.T, events ...string) sseSource {
+	t.Helper()
+	stop := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, ": roster stream\n\n")
+		for _, event := range events {
+			fmt.Fprint(w, event)
+		}
+		w.(http.Flusher).Flush()
+		select {
+		case <-stop:
+		case <-r.Context().Done():
+		}
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(stop) })
+	return sseSource{url: server.URL, csvUrl: os.Getenv("CSV_URL")}
+}
+
+// followStream runs one connection of the source without the reconnecting
+// loop of Members, which stays off for the test.
+func followStream(t *testing.T, source sseSource) {
+	t.Helper()
+	liveRoster.start.Do(func() {})
+	go source.stream()
+	t.Cleanup(func() {
+		liveRoster.Lock()
+		liveRoster.connected = false
+		liveRoster.Unlock()
+	})
+}
+
+func waitForMembers(t *testing.T, source sseSource, want []string) {
+	t.Helper()
+	var ids []string
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		liveRoster.Lock()
+		connected := liveRoster.connected
+		liveRoster.Unlock()
+		if !connected {
+			continue
+		}
+		members, err := source.Members()
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = nil
+		for _, member := range members {
+			ids = append(ids, member.ID+" "+member.FirstName)
+		}
+		if reflect.DeepEqual(ids, want) {
+			return
+		}
+	}
+	t.Fatalf("stream roster is %v, want %v", ids, want)
+}
+
+func TestSseEvents(t *testing.T) {
+	useSchema(t, apiSchema)
+	serveRosterCsv(t, apiRoster)
+	source := serveRosterStream(t,
+		"event: add\ndata: {\"id\": \"a3\", \"first_name\": \"Ann\", \"last_name\": \"Poe\",\ndata: \"email\": \"ann@example.com\", \"join_date\": \"2026-04-01\"}\n\n",
+		"event: update\ndata: {\"id\": \"a1\", \"first_name\": \"Janet\", \"last_name\": \"Doe\", \"email\": \"jane@example.com\", \"join_date\": \"2026-03-01\"}\n\n",
+		"event: remove\ndata: {\"id\": \"a2\"}\n\n",
+		"event: remove\ndata: {\"id\": \"nobody\"}\n\n",
+		"event: rename\ndata: {\"id\": \"a3\"}\n\n",
+	)
+	followStream(t, source)
+	waitForMembers(t, source, []string{"a1 Janet", "a3 Ann"})
+}
+
+// Without an id column, member IDs are derived and a remove carries the
+// member's record.
+func TestSseRemoveWithDerivedIds(t *testing.T) {
+	t.Setenv("CSV_SCHEMA", "")
+	serveRosterCsv(t, apiRoster)
+	source := serveRosterStream(t,
+		"event: remove\ndata: {\"id\": \"a1\"}\n\n",
+		"event: remove\ndata: {\"first_name\": \"John\", \"last_name\": \"Roe\", \"email\": \"john@example.com\", \"join_date\": \"2026-03-01\"}\n\n",
+	)
+	jane := deriveMemberId(Member{Email: "jane@example.com"})
+	followStream(t, source)
+	waitForMembers(t, source, []string{jane + " Jane"})
+}
+
+func TestSseFallsBackToCsv(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "down", http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	useSchema(t, apiSchema)
+	serveRosterCsv(t, apiRoster)
+	source := sseSource{url: down.URL, csvUrl: os.Getenv("CSV_URL")}
+	liveRoster.start.Do(func() {})
+
+	if err := source.stream(); err == nil {
+		t.Fatal("connecting to a down stream succeeded")
+	}
+	members, err := source.Members()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(members) != 2 || members[0].ID != "a1" || members[1].ID != "a2" {
+		t.Errorf("fallback roster %+v, want the CSV's a1 and a2", members)
+	}
+
+	source.csvUrl = ""
+	if _, err := source.Members(); err == nil {
+		t.Error("a down stream without CSV_URL served a roster")
+	}
+}
+
+// The stream gets SSE_CONNECT_TIMEOUT to answer, but once open it isn't
+// cut off.
+func TestSseConnectTimeout(t *testing.T) {
+	t.Setenv("SSE_CONNECT_TIMEOUT", "50ms")
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+	}))
+	defer slow.Close()
+	start := time.Now()
+	if err := (sseSource{url: slow.URL}).stream(); err == nil || time.Since(start) > 150*time.Millisecond {
+		t.Errorf("stream() = %v after %s, want a timeout within SSE_CONNECT_TIMEOUT", err, time.Since(start))
+	}
+
+	client, err := sseClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if client.Timeout != 0 {
+		t.Errorf("stream client timeout %s cuts off open streams", client.Timeout)
+	}
+}
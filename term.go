@@ -0,0 +1,56 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+// membershipTerm computes when a membership expires. By default it is
+// rolling, one year after joining. With a season anchor every membership
+// ends on the next anchor date after joining instead, optionally several
+// seasons out.
+type membershipTerm struct {
+	anchorMonth time.Month
+	anchorDay   int
+	seasons     int
+}
+
+// loadMembershipTerm reads SEASON_ANCHOR ("MM-DD", e.g. "09-01" for a
+// September to August season) and SEASON_COUNT (default 1).
+func loadMembershipTerm() (membershipTerm, error) {
+	term := membershipTerm{seasons: 1}
+	if value := os.Getenv("SEASON_COUNT"); value != "" {
+		seasons, err := strconv.Atoi(value)
+		if err != nil || seasons < 1 {
+			return membershipTerm{}, fmt.Errorf("SEASON_COUNT must be a positive number, got %q", value)
+		}
+		term.seasons = seasons
+	}
+
+	value := os.Getenv("SEASON_ANCHOR")
+	if value == "" {
+		return term, nil
+	}
+	// 2001 isn't a leap year, so February 29 is refused: it has no anchor
+	// most years.
+	anchor, err := time.Parse("2006-01-02", "2001-"+value)
+	if err != nil {
+		return membershipTerm{}, fmt.Errorf("SEASON_ANCHOR must be a MM-DD date, got %q", value)
+	}
+	term.anchorMonth = anchor.Month()
+	term.anchorDay = anchor.Day()
+	return term, nil
+}
+
+func (t membershipTerm) expiration(joinDate time.Time) time.Time {
+	if t.anchorMonth == 0 {
+		return joinDate.AddDate(t.seasons, 0, 0)
+	}
+	anchor := time.Date(joinDate.Year(), t.anchorMonth, t.anchorDay, 0, 0, 0, 0, joinDate.Location())
+	if !anchor.After(joinDate) {
+		anchor = anchor.AddDate(1, 0, 0)
+	}
+	return anchor.AddDate(t.seasons-1, 0, 0)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMembershipTermExpiration(t *testing.T) {
+	september := membershipTerm{anchorMonth: time.September, anchorDay: 1, seasons: 1}
+	tests := []struct {
+		name string
+		term membershipTerm
+		join string
+		want string
+	}{
+		{"rolling year", membershipTerm{seasons: 1}, "2026-03-15", "2027-03-15"},
+		{"rolling two years", membershipTerm{seasons: 2}, "2026-03-15", "2028-03-15"},
+		{"rolling from a leap day", membershipTerm{seasons: 1}, "2024-02-29", "2025-03-01"},
+		{"season, joined before the anchor", september, "2026-03-15", "2026-09-01"},
+		{"season, joined on the anchor", september, "2026-09-01", "2027-09-01"},
+		{"season, joined after the anchor", september, "2026-10-14", "2027-09-01"},
+		{"season, joined the day before", september, "2026-08-31", "2026-09-01"},
+		{"two seasons", membershipTerm{anchorMonth: time.September, anchorDay: 1, seasons: 2}, "2026-10-14", "2028-09-01"},
+		{"calendar year", membershipTerm{anchorMonth: time.January, anchorDay: 1, seasons: 1}, "2026-12-31", "2027-01-01"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.term.expiration(date(tt.join)); !got.Equal(date(tt.want)) {
+				t.Errorf("expiration(%s) = %s, want %s", tt.join, got.Format(time.DateOnly), tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadMembershipTerm(t *testing.T) {
+	tests := []struct {
+		anchor  string
+		count   string
+		want    membershipTerm
+		wantErr bool
+	}{
+		{want: membershipTerm{seasons: 1}},
+		{anchor: "09-01", want: membershipTerm{anchorMonth: time.September, anchorDay: 1, seasons: 1}},
+		{anchor: "09-01", count: "3", want: membershipTerm{anchorMonth: time.September, anchorDay: 1, seasons: 3}},
+		{anchor: "02-29", wantErr: true},
+		{anchor: "13-01", wantErr: true},
+		{anchor: "9/1", wantErr: true},
+		{count: "0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.anchor+" "+tt.count, func(t *testing.T) {
+			t.Setenv("SEASON_ANCHOR", tt.anchor)
+			t.Setenv("SEASON_COUNT", tt.count)
+			got, err := loadMembershipTerm()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("loadMembershipTerm() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("loadMembershipTerm() = %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
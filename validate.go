@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+type ValidationReport struct {
+	MemberCount int        `json:"member_count"`
+	Errors      []RowError `json:"errors"`
+	Warnings    []RowError `json:"warnings"`
+}
+
+// runValidate checks a roster CSV, read from path or from CSV_URL when path is
+// empty, and returns the process exit code: 0 when valid, 1 when there are
+// blocking errors and 2 when the roster couldn't be validated at all.
+func runValidate(path, format string, stdout io.Writer) int {
+	if format != "text" && format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q, expected text or json\n", format)
+		return 2
+	}
+
+	var body io.ReadCloser
+	var err error
+	if path != "" {
+		body, err = os.Open(path)
+	} else if url := os.Getenv("CSV_URL"); url != "" {
+		body, err = fetchCSV(url)
+	} else {
+		err = fmt.Errorf("no CSV file given and CSV_URL environment variable is not set")
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	defer body.Close()
+
+	result, err := parseCSV(context.Background(), body)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	report := ValidationReport{
+		MemberCount: len(result.Members),
+		Errors:      result.Errors,
+		Warnings:    result.Warnings,
+	}
+	if report.Errors == nil {
+		report.Errors = []RowError{}
+	}
+	if report.Warnings == nil {
+		report.Warnings = []RowError{}
+	}
+
+	if format == "json" {
+		if err := json.NewEncoder(stdout).Encode(report); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	} else {
+		printRowErrors(stdout, "error", report.Errors)
+		printRowErrors(stdout, "warning", report.Warnings)
+		fmt.Fprintf(stdout, "%d members, %d errors, %d warnings\n", report.MemberCount, len(report.Errors), len(report.Warnings))
+	}
+
+	if len(report.Errors) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func printRowErrors(w io.Writer, level string, rowErrors []RowError) {
+	for _, rowErr := range rowErrors {
+		if rowErr.Field == "" {
+			fmt.Fprintf(w, "%s: line %d: %s\n", level, rowErr.Line, rowErr.Reason)
+		} else {
+			fmt.Fprintf(w, "%s: line %d: %s: %s\n", level, rowErr.Line, rowErr.Field, rowErr.Reason)
+		}
+	}
+}
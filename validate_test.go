@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeRoster(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "roster.csv")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunValidateJson(t *testing.T) {
+	t.Setenv("CSV_SCHEMA", "")
+	tests := []struct {
+		name     string
+		roster   string
+		wantCode int
+		want     ValidationReport
+	}{
+		{
+			name:     "valid",
+			roster:   "n,first_name,last_name,email,roles,join_date\n1,Ada,Lovelace,ada@example.org,,01/03/2026\n",
+			wantCode: 0,
+			want:     ValidationReport{MemberCount: 1, Errors: []RowError{}, Warnings: []RowError{}},
+		},
+		{
+			name: "bad and short rows",
+			roster: "n,first_name,last_name,email,roles,join_date\n" +
+				"1,Ada,Lovelace,ada@example.org,,01/03/2026\n" +
+				"2,Grace,Hopper,grace@example.org,,someday\n" +
+				"3,Alan\n" +
+				"4,Edsger,Dijkstra,edsger@example.org,,01/03/2026\n",
+			wantCode: 1,
+			want: ValidationReport{
+				MemberCount: 2,
+				Errors:      []RowError{{Line: 3, Field: "join_date", Reason: "unable to parse date: someday"}},
+				Warnings:    []RowError{{Line: 4, Reason: "skipped, 2 columns instead of at least 6"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stdout bytes.Buffer
+			if code := runValidate(writeRoster(t, tt.roster), "json", &stdout); code != tt.wantCode {
+				t.Errorf("exit code = %d, want %d", code, tt.wantCode)
+			}
+			var fields map[string]json.RawMessage
+			if err := json.Unmarshal(stdout.Bytes(), &fields); err != nil {
+				t.Fatalf("output is not JSON: %v\n%s", err, stdout.String())
+			}
+			for _, key := range []string{"member_count", "errors", "warnings"} {
+				if _, ok := fields[key]; !ok {
+					t.Errorf("output has no %q key: %s", key, stdout.String())
+				}
+			}
+			var got ValidationReport
+			if err := json.Unmarshal(stdout.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("report = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunValidateUnreadableRoster(t *testing.T) {
+	var stdout bytes.Buffer
+	if code := runValidate(filepath.Join(t.TempDir(), "missing.csv"), "json", &stdout); code != 2 {
+		t.Errorf("exit code = %d, want 2", code)
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	texttemplate "text/template"
+)
+
+// Templates are parsed on first use and kept for the life of the process.
+var templateCache struct {
+	sync.Mutex
+	html map[string]*template.Template
+	json map[string]*texttemplate.Template
+}
+
+func htmlTemplate(file string) (*template.Template, error) {
+	templateCache.Lock()
+	defer templateCache.Unlock()
+	if t, ok := templateCache.html[file]; ok {
+		return t, nil
+	}
+	t, err := template.ParseFiles(file)
+	if err != nil {
+		return nil, err
+	}
+	if templateCache.html == nil {
+		templateCache.html = map[string]*template.Template{}
+	}
+	templateCache.html[file] = t
+	return t, nil
+}
+
+func jsonTemplate(file string) (*texttemplate.Template, error) {
+	templateCache.Lock()
+	defer templateCache.Unlock()
+	if t, ok := templateCache.json[file]; ok {
+		return t, nil
+	}
+	templateBytes, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error reading JSON template file: %v", err)
+	}
+	t, err := texttemplate.New("jsonTemplate").Funcs(texttemplate.FuncMap{"json": jsonString}).Parse(string(templateBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing JSON template: %v", err)
+	}
+	if templateCache.json == nil {
+		templateCache.json = map[string]*texttemplate.Template{}
+	}
+	templateCache.json[file] = t
+	return t, nil
+}
+
+// prewarmEnabled reads PREWARM: unless it is "false", the server parses its
+// templates, checks its credentials and fetches the roster before it starts
+// accepting requests.
+func prewarmEnabled() bool {
+	return os.Getenv("PREWARM") != "false"
+}
+
+var ready atomic.Bool
+
+func checkCredentials() error {
+	path, err := googleApplicationCredentials()
+	if err != nil {
+		return err
+	}
+	credentialBytes, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading Google credentials: %v", err)
+	}
+	var credentials struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+	}
+	if err := json.Unmarshal(credentialBytes, &credentials); err != nil {
+		return fmt.Errorf("error parsing Google credentials: %v", err)
+	}
+	if credentials.ClientEmail == "" || credentials.PrivateKey == "" {
+		return fmt.Errorf("Google credentials %s lack client_email or private_key", path)
+	}
+	return nil
+}
+
+// warmUp does the first-request work ahead of time. Broken templates stop the
+// server since no page would render; credential and roster problems are only
+// logged, as they can be fixed without a restart.
+func warmUp() {
+	if _, err := htmlTemplate("home.html"); err != nil {
+		log.Fatalf("Error parsing home.html: %v", err)
+	}
+	for _, file := range []string{"./google_card.json", "./google_class.json"} {
+		if _, err := jsonTemplate(file); err != nil {
+			log.Fatalf("Error loading %s: %v", file, err)
+		}
+	}
+	if err := checkCredentials(); err != nil {
+		log.Printf("Warning: %v", err)
+	}
+	if _, _, err := loadRoster(); err != nil {
+		log.Printf("Warning: first roster fetch failed: %v", err)
+	}
+	ready.Store(true)
+	log.Printf("Warm-up done, ready to serve")
+}
+
+// healthzHandler is the readiness check: 503 until warm-up completes, which
+// with PREWARM is before the server listens.
+func healthzHandler(w http.ResponseWriter, r *http.Request) {
+	if !ready.Load() {
+		http.Error(w, "warming up", http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
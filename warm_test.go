@@ -0,0 +1,86 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func resetTemplateCache() {
+	templateCache.Lock()
+	templateCache.html, templateCache.json = nil, nil
+	templateCache.Unlock()
+}
+
+// After warm-up, requests get the templates parsed during warm-up instead of
+// parsing them again.
+func TestWarmUpParsesTemplatesAhead(t *testing.T) {
+	serveRosterCsv(t, apiRoster)
+	resetTemplateCache()
+	ready.Store(false)
+	defer ready.Store(true)
+
+	warmUp()
+	templateCache.Lock()
+	home := templateCache.html["home.html"]
+	card := templateCache.json["./google_card.json"]
+	templateCache.Unlock()
+	if home == nil || card == nil {
+		t.Fatal("warm-up didn't parse the templates")
+	}
+
+	rec := httptest.NewRecorder()
+	viewHomeHandler(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("home page: status %d: %s", rec.Code, rec.Body)
+	}
+	if served, _ := htmlTemplate("home.html"); served != home {
+		t.Error("the home page parsed home.html again after warm-up")
+	}
+	if served, _ := jsonTemplate("./google_card.json"); served != card {
+		t.Error("google_card.json was parsed again after warm-up")
+	}
+	rec = httptest.NewRecorder()
+	healthzHandler(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	if rec.Code != http.StatusOK {
+		t.Errorf("/healthz after warm-up: status %d", rec.Code)
+	}
+}
+
+// A first, cold render pays for parsing the template; a warm one doesn't.
+func TestWarmTemplateLookupIsCheap(t *testing.T) {
+	resetTemplateCache()
+	start := time.Now()
+	if _, err := htmlTemplate("home.html"); err != nil {
+		t.Fatal(err)
+	}
+	cold := time.Since(start)
+	start = time.Now()
+	for i := 0; i < 100; i++ {
+		htmlTemplate("home.html")
+	}
+	if warm := time.Since(start) / 100; warm > cold {
+		t.Errorf("warm lookup took %s, the cold parse %s", warm, cold)
+	}
+}
+
+func BenchmarkHomeTemplateCold(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		resetTemplateCache()
+		if _, err := htmlTemplate("home.html"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkHomeTemplateWarm(b *testing.B) {
+	resetTemplateCache()
+	htmlTemplate("home.html")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := htmlTemplate("home.html"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The workbook is written by hand: it has a single sheet and three cell
+// styles, which doesn't warrant a spreadsheet dependency.
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+</Types>`
+	xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<sheets><sheet name="Members" sheetId="1" r:id="rId1"/></sheets>
+</workbook>`
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+</Relationships>`
+	// Cell styles: 0 is the default, 1 a date (built-in format 14) and 2 a
+	// bold header.
+	xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/></cellXfs>
+</styleSheet>`
+)
+
+const (
+	xlsxStyleDate   = 1
+	xlsxStyleHeader = 2
+)
+
+type xlsxCell struct {
+	text  string
+	date  time.Time
+	style int
+}
+
+func xlsxColumnName(index int) string {
+	name := ""
+	for index++; index > 0; index = (index - 1) / 26 {
+		name = string(rune('A'+(index-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxDateSerial converts a date to the spreadsheet day count since
+// 1899-12-30.
+func xlsxDateSerial(date time.Time) int {
+	return daysBetween(time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC), date)
+}
+
+func writeXlsxSheet(w io.Writer, rows [][]xlsxCell) error {
+	var sheet strings.Builder
+	sheet.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+	for r, row := range rows {
+		fmt.Fprintf(&sheet, `<row r="%d">`, r+1)
+		for c, cell := range row {
+			ref := fmt.Sprintf("%s%d", xlsxColumnName(c), r+1)
+			if !cell.date.IsZero() {
+				fmt.Fprintf(&sheet, `<c r="%s" s="%d"><v>%d</v></c>`, ref, xlsxStyleDate, xlsxDateSerial(cell.date))
+				continue
+			}
+			fmt.Fprintf(&sheet, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">`, ref, cell.style)
+			if err := xml.EscapeText(&sheet, []byte(cell.text)); err != nil {
+				return err
+			}
+			sheet.WriteString(`</t></is></c>`)
+		}
+		sheet.WriteString(`</row>`)
+	}
+	sheet.WriteString(`</sheetData></worksheet>`)
+	_, err := io.WriteString(w, sheet.String())
+	return err
+}
+
+func writeXlsx(w io.Writer, rows [][]xlsxCell) error {
+	archive := zip.NewWriter(w)
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", xlsxWorkbook},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for _, part := range parts {
+		f, err := archive.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+	f, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return err
+	}
+	if err := writeXlsxSheet(f, rows); err != nil {
+		return err
+	}
+	return archive.Close()
+}
+
+// membersXlsxRows lays out the roster with a header row, typed date columns,
+// the membership status of each member and the extra schema columns.
+func membersXlsxRows(members []Member, statuses []string, schema *Schema) [][]xlsxCell {
+	headers := []string{"ID", "First Name", "Last Name", "Email", "Join Date", "Member Since", "Expiration Date", "Membership"}
+	var extraFields []string
+	for _, column := range schema.Columns {
+		switch column.Name {
+		case "id", "first_name", "last_name", "email", "join_date", "member_since":
+			continue
+		}
+		extraFields = append(extraFields, column.Name)
+		headers = append(headers, column.Name)
+	}
+
+	var header []xlsxCell
+	for _, name := range headers {
+		header = append(header, xlsxCell{text: name, style: xlsxStyleHeader})
+	}
+	rows := [][]xlsxCell{header}
+	for i, member := range members {
+		row := []xlsxCell{
+			{text: member.ID},
+			{text: member.FirstName},
+			{text: member.LastName},
+			{text: member.Email},
+			{date: member.JoinDate},
+			{date: member.MemberSince},
+			{date: member.ExpirationDate},
+			{text: statuses[i]},
+		}
+		for _, field := range extraFields {
+			row = append(row, xlsxCell{text: strings.Join(memberFieldValues(member, field), ", ")})
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
+
+func membersXlsxHandler(w http.ResponseWriter, r *http.Request) {
+	schema, err := csvSchema()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	filter, err := parseMemberFilter(r.URL.Query(), schema)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	redacted, ok := redactionFor(w, r, filter)
+	if !ok {
+		return
+	}
+
+	members, ok := serveRoster(w)
+	if !ok {
+		return
+	}
+
+	// Statuses are computed before redacting, the active rule may read
+	// redacted fields.
+	var selected []Member
+	var statuses []string
+	for _, member := range members {
+		if filter.matches(member) {
+			statuses = append(statuses, member.Status(filter.rule, filter.now))
+			selected = append(selected, redactMember(member, redacted))
+		}
+	}
+
+	var workbook bytes.Buffer
+	if err := writeXlsx(&workbook, membersXlsxRows(selected, statuses, schema)); err != nil {
+		http.Error(w, "Error generating workbook: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet")
+	w.Header().Set("Content-Disposition", `attachment; filename="members.xlsx"`)
+	w.Write(workbook.Bytes())
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// xlsxSheet is the part of a worksheet the export test reads back.
+type xlsxSheet struct {
+	Rows []struct {
+		Cells []struct {
+			Ref    string `xml:"r,attr"`
+			Style  int    `xml:"s,attr"`
+			Value  string `xml:"v"`
+			Inline string `xml:"is>t"`
+		} `xml:"c"`
+	} `xml:"sheetData>row"`
+}
+
+func TestMembersXlsxExport(t *testing.T) {
+	serveRosterCsv(t, apiRoster)
+	useSchema(t, apiSchema)
+	t.Setenv("ACTIVE_RULE", "status=paid")
+	rec := httptest.NewRecorder()
+	membersXlsxHandler(rec, httptest.NewRequest(http.MethodGet, "/api/members.xlsx", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet" {
+		t.Fatalf("status %d, Content-Type %q: %s", rec.Code, rec.Header().Get("Content-Type"), rec.Body)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(rec.Body.Bytes()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("the export is not a zip archive: %v", err)
+	}
+	parts := map[string][]byte{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Every part is well-formed XML.
+		decoder := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+		}
+		parts[f.Name] = content
+	}
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels", "xl/styles.xml", "xl/worksheets/sheet1.xml"} {
+		if parts[name] == nil {
+			t.Errorf("the export has no %s part", name)
+		}
+	}
+
+	var sheet xlsxSheet
+	if err := xml.Unmarshal(parts["xl/worksheets/sheet1.xml"], &sheet); err != nil {
+		t.Fatal(err)
+	}
+	var rows [][]string
+	for _, row := range sheet.Rows {
+		var values []string
+		for _, cell := range row.Cells {
+			values = append(values, cell.Inline+cell.Value)
+		}
+		rows = append(rows, values)
+	}
+	// Dates are day serials: 46082 is 2026-03-01 and 46447 a year later.
+	want := [][]string{
+		{"ID", "First Name", "Last Name", "Email", "Join Date", "Member Since", "Expiration Date", "Membership", "status"},
+		{"a1", "Jane", "Doe", "jane@example.com", "46082", "46082", "46447", "active", "paid"},
+		{"a2", "John", "Roe", "john@example.com", "46082", "46082", "46447", "inactive", "due"},
+	}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("sheet rows\n%q\nwant\n%q", rows, want)
+	}
+	if header, date := sheet.Rows[0].Cells[0], sheet.Rows[1].Cells[4]; header.Style != xlsxStyleHeader || date.Style != xlsxStyleDate || date.Ref != "E2" {
+		t.Errorf("header cell %+v, date cell %+v, want the header and date styles", header, date)
+	}
+}